@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/database"
+	"github.com/prosperitybot/worker/internal/metrics"
+	"github.com/prosperitybot/worker/internal/tracing"
+)
+
+func setupDatabase(cfg config.Database, tracer tracing.Tracer) (*sqlx.DB, error) {
+	db, err := tracer.OpenDB(database.WrapDriver(&mysql.MySQLDriver{}, metrics.DatabaseHook), cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.Pool.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Pool.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.Pool.ConnMaxIdleTime)
+
+	return sqlx.NewDb(db, "mysql"), nil
+}
+
+// setupDatabases opens the primary database and, when configured, its read
+// replica.
+func setupDatabases(cfg config.Database, tracer tracing.Tracer) (database.DB, error) {
+	writer, err := setupDatabase(cfg, tracer)
+	if err != nil {
+		return database.DB{}, err
+	}
+
+	replicaCfg, ok := cfg.Replica()
+	if !ok {
+		return database.NewDB(writer, nil), nil
+	}
+
+	reader, err := setupDatabase(replicaCfg, tracer)
+	if err != nil {
+		writer.Close()
+		return database.DB{}, err
+	}
+
+	return database.NewDB(writer, reader), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/worker/internal/background"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/cooldown"
+	"github.com/prosperitybot/worker/internal/database"
+	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/command"
+	"github.com/prosperitybot/worker/internal/discord/component"
+	"github.com/prosperitybot/worker/internal/discord/customid"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/rank"
+	"github.com/prosperitybot/worker/internal/store"
+)
+
+type interactions struct {
+	commands   map[string]discord.SlashCommand
+	components map[string]discord.Component
+	customIds  customid.Codec
+}
+
+// newInteractions builds every command and component. Commands that only
+// read, and can show data a little behind, use db's reader. discordClient is
+// shared with the rest of the worker so they all respect the same rate
+// limits, jobs runs work that outlives the interaction's request, cooldowns
+// stores the overrides set with /settings cooldown, guilds caches guild
+// settings and level roles and ranks looks up leaderboard positions.
+func newInteractions(cfg config.Config, db database.DB, publicKeyCache *cache.PublicKeyCache, registrar *register.Registrar, discordClient rest.Client, jobs *background.Runner, cooldowns *cooldown.Limiter, guilds *store.Store, ranks *rank.Service) interactions {
+	key := []byte(cfg.Discord.CustomIdSecret)
+	if len(key) == 0 {
+		key = customid.DeriveKey(cfg.Discord.BotToken)
+	}
+	customIds := customid.NewCodec(key)
+
+	components := map[string]discord.Component{
+		component.LeaderboardPageId:   component.NewLeaderboardPageComponent(ranks, customIds),
+		"settings::notifications":     component.NewSettingsNotificationComponent(db.Writer, guilds),
+		"whitelabel::botselection":    component.NewWhitelabelBotSelectionComponent(db.Writer, customIds),
+		component.WhitelabelActionsId: component.NewWhitelabelActionsComponent(db.Writer, registrar, jobs),
+	}
+
+	commands := map[string]discord.SlashCommand{
+		"about":       command.NewAboutCommand(db.Reader),
+		"ignored":     command.NewIgnoredCommand(db.Writer),
+		"leaderboard": command.NewLeaderboardCommand(ranks, components[component.LeaderboardPageId].(component.LeaderboardPageComponent)),
+		"level":       command.NewLevelCommand(db.Reader, ranks),
+		"levelroles":  command.NewLevelRolesCommand(db.Writer, guilds, discordClient.WithToken(cfg.Discord.BotToken), jobs),
+		"levels":      command.NewLevelsCommand(db.Writer),
+		"whitelabel":  command.NewWhitelabelCommand(db.Writer, publicKeyCache, registrar, discordClient, jobs, cfg.WorkerBaseURL),
+		"xp":          command.NewXpCommand(db.Writer),
+	}
+
+	// Settings offers the cooldowns of every other command
+	commands["settings"] = command.NewSettingsCommand(
+		db.Writer,
+		guilds,
+		components["settings::notifications"].(component.SettingsNotificationComponent),
+		cooldowns,
+		discord.Cooldowns(commands),
+	)
+
+	registrar.SetCommands(commandList(commands))
+
+	return interactions{
+		commands:   commands,
+		components: components,
+		customIds:  customIds,
+	}
+}
+
+func commandList(commands map[string]discord.SlashCommand) []discordgo.ApplicationCommand {
+	list := make([]discordgo.ApplicationCommand, 0, len(commands))
+	for name := range commands {
+		list = append(list, commands[name].Command())
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
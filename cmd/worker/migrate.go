@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/migrate"
+	"github.com/prosperitybot/worker/internal/tracing"
+)
+
+func runMigrate(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert when running down")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: worker migrate [up|down|status] [--steps n]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	direction := "up"
+	if flags.NArg() > 0 {
+		direction = flags.Arg(0)
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.Database.Validate(); err != nil {
+		return err
+	}
+
+	db, err := setupDatabase(cfg.Database, tracing.Noop())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch direction {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		// status is printed below
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate direction %q", direction)
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrator.Migrations() {
+		state := "pending"
+		if migration.Version <= version {
+			state = "applied"
+		}
+		fmt.Printf("%04d_%s\t%s\n", migration.Version, migration.Name, state)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/prosperitybot/worker/internal/background"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/cooldown"
+	"github.com/prosperitybot/worker/internal/database"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/rank"
+	"github.com/prosperitybot/worker/internal/store"
+)
+
+func runPrintCommands(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("print-commands", flag.ExitOnError)
+	asJson := flags.Bool("json", false, "print the full command schema as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Command definitions never touch the database so there is no need to
+	// connect to one.
+	interactions := newInteractions(cfg, database.DB{}, cache.NewPublicKeyCache(nil, 0, 0, 0, false), register.NewRegistrar(nil, rest.Client{}, ""), rest.Client{}, background.NewRunner(), cooldown.NewLimiter(nil, 0), store.NewStore(database.DB{}, 0, 0, false), rank.NewService(nil, 0))
+	commands := commandList(interactions.commands)
+
+	if *asJson {
+		data, err := json.MarshalIndent(commands, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tHASH\tDESCRIPTION")
+	for _, command := range commands {
+		fmt.Fprintf(writer, "/%s\t%s\t%s\n", command.Name, register.Hash(command)[:12], command.Description)
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/common/model"
+	"github.com/prosperitybot/worker/internal/background"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/cooldown"
+	"github.com/prosperitybot/worker/internal/database"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/rank"
+	"github.com/prosperitybot/worker/internal/store"
+	"github.com/prosperitybot/worker/internal/tracing"
+)
+
+func runRegisterCommands(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("register-commands", flag.ExitOnError)
+	botId := flags.String("bot", "", "only register commands for this bot (defaults to the main bot and every whitelabel bot)")
+	guildId := flags.String("guild", cfg.CommandGuildId(), "register the commands in this guild instead of globally")
+	dryRun := flags.Bool("dry-run", false, "print the changes without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := cfg.Discord.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		return err
+	}
+
+	db, err := setupDatabase(cfg.Database, tracing.Noop())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	discordClient := rest.NewClient(cfg.Discord.APIBaseURL, "")
+	registrar := register.NewRegistrar(db, discordClient, *guildId)
+	newInteractions(cfg, database.NewDB(db, nil), cache.NewPublicKeyCache(db, cache.DefaultPublicKeySize, cache.DefaultPublicKeyTTL, cache.DefaultPublicKeyNegativeTTL, false), registrar, discordClient, background.NewRunner(), cooldown.NewLimiter(db, cooldown.DefaultOverrideTTL), store.NewStore(database.NewDB(db, nil), store.DefaultTTL, 0, false), rank.NewService(db, rank.DefaultTotalTTL))
+
+	var bots []model.WhitelabelBot
+
+	mainBot := model.WhitelabelBot{Id: cfg.Discord.ApplicationId, Token: cfg.Discord.BotToken}
+
+	switch *botId {
+	case "":
+		whitelabelBots, err := registrar.WhitelabelBots(ctx)
+		if err != nil {
+			return err
+		}
+		bots = append([]model.WhitelabelBot{mainBot}, whitelabelBots...)
+	case mainBot.Id:
+		bots = []model.WhitelabelBot{mainBot}
+	default:
+		bot, err := whitelabelBot(ctx, db, *botId)
+		if err != nil {
+			return err
+		}
+		bots = []model.WhitelabelBot{bot}
+	}
+
+	failed := 0
+	for i := range bots {
+		client := discordClient.WithToken(bots[i].Token)
+
+		plan, err := registrar.Plan(ctx, client, bots[i].Id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bot %s: %s\n", bots[i].Id, err)
+			failed++
+			continue
+		}
+
+		fmt.Print(plan.String())
+
+		if *dryRun {
+			continue
+		}
+
+		if err := registrar.Apply(ctx, client, plan); err != nil {
+			fmt.Fprintf(os.Stderr, "bot %s: %s\n", bots[i].Id, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("registering commands failed for %d of %d bots", failed, len(bots))
+	}
+
+	return nil
+}
+
+func whitelabelBot(ctx context.Context, db *sqlx.DB, botId string) (model.WhitelabelBot, error) {
+	var bot model.WhitelabelBot
+
+	if err := db.GetContext(ctx, &bot, "SELECT botId, token FROM whitelabel_bots WHERE botId = ?", botId); err != nil {
+		return bot, fmt.Errorf("getting whitelabel bot %s: %w", botId, err)
+	}
+
+	return bot, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/worker/internal/background"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/cooldown"
+	"github.com/prosperitybot/worker/internal/database"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/discord/rest/resttest"
+	"github.com/prosperitybot/worker/internal/http/handler"
+	"github.com/prosperitybot/worker/internal/rank"
+	"github.com/prosperitybot/worker/internal/recorder"
+	"github.com/prosperitybot/worker/internal/store"
+	"github.com/prosperitybot/worker/internal/tracing"
+)
+
+// runReplay feeds interactions recorded with RECORD_INTERACTIONS_DIR back
+// through the interaction handler against the configured (local) database,
+// which it refuses to do in prod without -allow-writes as recorded commands
+// change what they are replayed against. Signatures and cooldowns are not
+// checked and, unless -discord-url is given, Discord is replaced by a
+// stand-in that answers every call with a 404 so nothing is changed on
+// Discord. Components carrying signed state only replay when CUSTOM_ID_SECRET
+// matches the one they were recorded with.
+func runReplay(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	discordURL := flags.String("discord-url", "", "send Discord API calls here instead of to a local stand-in")
+	interactionId := flags.String("interaction", "", "only replay the interaction with this ID")
+	verbose := flags.Bool("v", false, "print every response, not just the ones that differ")
+	allowWrites := flags.Bool("allow-writes", false, "replay even though ENV is prod, writing to its database")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: worker replay [flags] <recording.jsonl>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if cfg.Env == "prod" && !*allowWrites {
+		return fmt.Errorf("refusing to replay against the prod database, pass -allow-writes to do it anyway")
+	}
+
+	if err := cfg.Database.Validate(); err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := recorder.Read(file)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", flags.Arg(0), err)
+	}
+
+	db, err := setupDatabase(cfg.Database, tracing.Noop())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var standIn *resttest.Server
+	if *discordURL == "" {
+		standIn = resttest.New()
+		defer standIn.Close()
+
+		cfg.Discord.APIBaseURL = standIn.URL()
+	} else {
+		cfg.Discord.APIBaseURL = *discordURL
+	}
+
+	var (
+		discordClient  = rest.NewClient(cfg.Discord.APIBaseURL, "")
+		publicKeyCache = cache.NewPublicKeyCache(db, cache.DefaultPublicKeySize, cache.DefaultPublicKeyTTL, cache.DefaultPublicKeyNegativeTTL, false)
+		registrar      = register.NewRegistrar(db, discordClient, cfg.CommandGuildId())
+		jobs           = background.NewRunner()
+		interactions   = newInteractions(cfg, database.NewDB(db, nil), publicKeyCache, registrar, discordClient, jobs, cooldown.NewLimiter(db, cooldown.DefaultOverrideTTL), store.NewStore(database.NewDB(db, nil), store.DefaultTTL, 0, false), rank.NewService(db, rank.DefaultTotalTTL))
+	)
+
+	interactionHandler := handler.InteractionHandler{
+		Commands:   interactions.commands,
+		Components: interactions.components,
+		Tracer:     tracing.Noop(),
+		CustomIds:  interactions.customIds,
+		Discord:    discordClient,
+	}
+
+	e := echo.New()
+	e.POST("/interactions/:bot_id", interactionHandler.POSTInteractions)
+
+	replayed, differed := 0, 0
+	for n, entry := range entries {
+		var interaction discordgo.Interaction
+		if err := json.Unmarshal(entry.Interaction, &interaction); err != nil {
+			return fmt.Errorf("entry %d: %w", n+1, err)
+		}
+		if *interactionId != "" && interaction.ID != *interactionId {
+			continue
+		}
+
+		var calls int
+		if standIn != nil {
+			calls = len(standIn.Calls())
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/interactions/"+entry.BotId, bytes.NewReader(entry.Interaction))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// Include the calls made by work the interaction started
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := jobs.Wait(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("waiting for the jobs started by %s: %w", interaction.ID, err)
+		}
+
+		replayed++
+		same := rec.Code == entry.Status && sameJSON(rec.Body.Bytes(), entry.Response)
+		if !same {
+			differed++
+		}
+
+		fmt.Printf("%s %s %s: recorded %d, replayed %d\n", entry.Time.Format("2006-01-02 15:04:05"), interaction.ID, describe(interaction), entry.Status, rec.Code)
+		if !same || *verbose {
+			fmt.Printf("  recorded: %s\n  replayed: %s\n", bytes.TrimSpace(entry.Response), bytes.TrimSpace(rec.Body.Bytes()))
+		}
+		if standIn != nil {
+			for _, call := range standIn.Calls()[calls:] {
+				fmt.Printf("  discord: %s %s\n", call.Method, call.Path)
+			}
+		}
+	}
+
+	fmt.Printf("\nReplayed %d interactions, %d responded differently\n", replayed, differed)
+
+	return nil
+}
+
+func describe(interaction discordgo.Interaction) string {
+	switch interaction.Type {
+	case discordgo.InteractionApplicationCommand:
+		return "/" + interaction.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		return "component " + interaction.MessageComponentData().CustomID
+	}
+	return interaction.Type.String()
+}
+
+func sameJSON(a []byte, b []byte) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(bytes.TrimSpace(a), bytes.TrimSpace(b))
+	}
+
+	xs, _ := json.Marshal(x)
+	ys, _ := json.Marshal(y)
+	return bytes.Equal(xs, ys)
+}
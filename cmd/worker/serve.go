@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/brpaz/echozap"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prosperitybot/common/logger"
+	"github.com/prosperitybot/worker/internal/background"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/cooldown"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/http/handler"
+	"github.com/prosperitybot/worker/internal/http/middleware"
+	"github.com/prosperitybot/worker/internal/idempotency"
+	"github.com/prosperitybot/worker/internal/metrics"
+	"github.com/prosperitybot/worker/internal/migrate"
+	"github.com/prosperitybot/worker/internal/rank"
+	"github.com/prosperitybot/worker/internal/recorder"
+	"github.com/prosperitybot/worker/internal/store"
+	"github.com/prosperitybot/worker/internal/tracing"
+	"go.uber.org/zap"
+)
+
+func runServe(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	address := flags.String("address", fmt.Sprintf(":%d", cfg.Port), "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	mainPublicKey, err := cfg.Discord.DecodedPublicKey()
+	if err != nil {
+		return err
+	}
+
+	tracer, err := tracing.New(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := tracer.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Error flushing traces", zap.Error(err))
+		}
+	}()
+
+	databases, err := setupDatabases(cfg.Database, tracer)
+	if err != nil {
+		return err
+	}
+	defer databases.Close()
+
+	db := databases.Writer
+	if err := metrics.RegisterDatabase(db, "worker"); err != nil {
+		return err
+	}
+	if databases.Replicated() {
+		if err := metrics.RegisterDatabase(databases.Reader, "worker-replica"); err != nil {
+			return err
+		}
+	}
+
+	var (
+		draining = &atomic.Bool{}
+		jobs     = background.NewRunner()
+	)
+
+	echoInstance := echo.New()
+
+	echoInstance.Use(tracer.Middleware())
+
+	// Auth group
+	authGroup := echoInstance.Group("")
+
+	publicKeyCache := cache.NewPublicKeyCache(db, cache.DefaultPublicKeySize, cache.DefaultPublicKeyTTL, cache.DefaultPublicKeyNegativeTTL, cfg.Cache.PollInterval > 0)
+	middlewareHandler := middleware.NewMiddlewareHandler(cfg.Discord.ApplicationId, mainPublicKey, publicKeyCache, cfg.Discord.MaxTimestampSkew)
+
+	authGroup.Use(middlewareHandler.InteractionAuthMiddleware)
+	echoInstance.Use(echozap.ZapLogger(logger.GetLogger()))
+
+	discordClient := rest.NewClient(cfg.Discord.APIBaseURL, "")
+	registrar := register.NewRegistrar(db, discordClient, cfg.CommandGuildId())
+	cooldowns := cooldown.NewLimiter(db, cooldown.DefaultOverrideTTL)
+	guildStore := store.NewStore(databases, cfg.Cache.TTL, cfg.Database.ReplicaLag, cfg.Cache.PollInterval > 0)
+	ranks := rank.NewService(databases.Reader, rank.DefaultTotalTTL)
+	interactions := newInteractions(cfg, databases, publicKeyCache, registrar, discordClient, jobs, cooldowns, guildStore, ranks)
+
+	idempotencyStore := idempotency.NewStore(db, idempotency.DefaultSize, idempotency.DefaultWait)
+
+	interactionHandler := handler.InteractionHandler{
+		Commands:    interactions.commands,
+		Components:  interactions.components,
+		Tracer:      tracer,
+		Idempotency: idempotencyStore,
+		Cooldowns:   cooldowns,
+		CustomIds:   interactions.customIds,
+		Discord:     discordClient,
+	}
+
+	migrator, err := migrate.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	healthHandler := handler.HealthHandler{
+		Db:       db,
+		Draining: draining,
+		Checks: []handler.HealthCheck{
+			handler.DatabaseCheck(db),
+			handler.MigrationsCheck(migrator),
+			handler.CommandsCheck(registrar, cfg.Discord.ApplicationId),
+			handler.PublicKeysCheck(mainPublicKey, publicKeyCache),
+		},
+	}
+	if databases.Replicated() {
+		replicaCheck := handler.DatabaseCheck(databases.Reader)
+		replicaCheck.Name = "database-replica"
+		healthHandler.Checks = append(healthHandler.Checks, replicaCheck)
+	}
+
+	jobs.Go("register-commands", func(ctx context.Context) {
+		registrar.RegisterWithRetry(ctx, cfg.Discord.ApplicationId, cfg.Discord.BotToken, register.DefaultRetryInterval)
+	})
+
+	jobs.Go("idempotency-pruner", func(ctx context.Context) {
+		idempotencyStore.Run(ctx, idempotency.DefaultPruneInterval, idempotency.DefaultRetention)
+	})
+
+	jobs.Go("public-key-cache", func(ctx context.Context) {
+		interval := cfg.Cache.PollInterval
+		if interval == 0 {
+			interval = cache.DefaultPublicKeyPruneInterval
+		}
+		publicKeyCache.Run(ctx, interval)
+	})
+
+	jobs.Go("cooldown-pruner", func(ctx context.Context) {
+		cooldowns.Run(ctx, cooldown.DefaultPruneInterval)
+	})
+
+	jobs.Go("rank-pruner", func(ctx context.Context) {
+		ranks.Run(ctx, rank.DefaultPruneInterval)
+	})
+
+	jobs.Go("guild-cache", func(ctx context.Context) {
+		// Without polling this only prunes, which is frequent enough every TTL
+		interval := cfg.Cache.PollInterval
+		if interval == 0 {
+			interval = cfg.Cache.TTL
+		}
+		guildStore.Run(ctx, interval)
+	})
+
+	if cfg.Env == "prod" {
+		jobs.Go("command-reconciler", func(ctx context.Context) {
+			registrar.Run(ctx, register.DefaultReconcileInterval)
+		})
+	}
+
+	// Routes
+	echoInstance.GET("/health", healthHandler.GETHealth)
+	echoInstance.GET("/livez", healthHandler.GETLivez)
+	echoInstance.GET("/readyz", healthHandler.GETReadyz)
+	echoInstance.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	var interactionMiddleware []echo.MiddlewareFunc
+	if cfg.Recording.Dir != "" {
+		interactionRecorder, err := recorder.New(cfg.Recording.Dir, cfg.Recording.Guilds)
+		if err != nil {
+			return err
+		}
+		defer interactionRecorder.Close()
+
+		logger.Warn(context.Background(), "Recording interactions", zap.String("dir", cfg.Recording.Dir), zap.Strings("guilds", cfg.Recording.Guilds))
+		interactionMiddleware = append(interactionMiddleware, interactionRecorder.Middleware())
+	}
+	authGroup.POST("/interactions/:bot_id", interactionHandler.POSTInteractions, interactionMiddleware...)
+
+	data, _ := json.MarshalIndent(echoInstance.Routes(), "", "  ")
+	logger.Debug(context.Background(), string(data))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- echoInstance.Start(*address)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		stop()
+	}
+
+	return shutdown(cfg.Shutdown, echoInstance, jobs, draining)
+}
+
+// shutdown marks the worker as draining so /readyz fails and the load
+// balancer stops sending it interactions, then stops accepting connections and
+// waits for in-flight interactions and background jobs. Tracing and the
+// database pool are closed by runServe's deferred calls once this returns.
+func shutdown(cfg config.Shutdown, echoInstance *echo.Echo, jobs *background.Runner, draining *atomic.Bool) error {
+	logger.Info(context.Background(), "Shutting down", zap.Duration("drainDelay", cfg.DrainDelay), zap.Duration("timeout", cfg.Timeout))
+
+	draining.Store(true)
+	time.Sleep(cfg.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	if err := echoInstance.Shutdown(ctx); err != nil {
+		logger.Error(ctx, "Error waiting for in-flight interactions", zap.Error(err))
+	}
+
+	if err := jobs.Shutdown(ctx); err != nil {
+		logger.Error(ctx, "Error waiting for background jobs", zap.Error(err))
+	}
+
+	logger.Info(context.Background(), "Shutdown complete")
+
+	return nil
+}
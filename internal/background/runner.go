@@ -0,0 +1,67 @@
+package background
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prosperitybot/common/logger"
+	"go.uber.org/zap"
+)
+
+// Runner tracks goroutines started outside of a request so that shutdown can
+// wait for them. The context handed to each job is cancelled when Shutdown is
+// called; long running loops should return when it is, one-off jobs are
+// expected to finish what they are doing.
+type Runner struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (r *Runner) Go(name string, fn func(ctx context.Context)) {
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error(r.ctx, "Background job panicked", zap.String("job", name), zap.Any("panic", err), zap.Stack("stack"))
+			}
+		}()
+
+		fn(r.ctx)
+	}()
+}
+
+// Shutdown cancels the jobs' context and waits for them to return, giving up
+// when ctx is done.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.cancel()
+
+	return r.Wait(ctx)
+}
+
+// Wait waits for the jobs started so far to return without cancelling them,
+// giving up when ctx is done.
+func (r *Runner) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func NewRunner() *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
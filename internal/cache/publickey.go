@@ -0,0 +1,265 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/common/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultPublicKeySize          = 10000
+	DefaultPublicKeyTTL           = 10 * time.Minute
+	DefaultPublicKeyNegativeTTL   = time.Minute
+	DefaultPublicKeyPruneInterval = 5 * time.Minute
+)
+
+type publicKeyEntry struct {
+	botId     string
+	key       ed25519.PublicKey
+	found     bool
+	expiresAt time.Time
+}
+
+// PublicKeyCache holds the decoded public keys of whitelabel bots so that
+// verifying an interaction does not need a database round trip. Bots that do
+// not exist are cached as well (for a shorter time) to stop unknown bot IDs
+// from hitting the database on every request. As anyone can send requests for
+// unknown bot IDs, the cache is a bounded LRU.
+//
+// Anything changing a bot's public key must call Invalidate afterwards. A
+// shared cache also records invalidations in public_key_versions, where the
+// caches of other workers pick them up in Run.
+type PublicKeyCache struct {
+	db          *sqlx.DB
+	size        int
+	ttl         time.Duration
+	negativeTtl time.Duration
+	shared      bool
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	// since is the time of the latest public_key_versions change polled. The
+	// next poll returns the changes made at exactly that time again, seen
+	// holds their versions so they aren't counted twice.
+	since time.Time
+	seen  map[string]int64
+}
+
+func (p *PublicKeyCache) Get(ctx context.Context, botId string) (ed25519.PublicKey, bool, error) {
+	if entry, ok := p.get(botId); ok {
+		return entry.key, entry.found, nil
+	}
+
+	var publicKey sql.NullString
+	if err := p.db.GetContext(ctx, &publicKey, "SELECT publicKey FROM whitelabel_bots WHERE botId = ?", botId); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, false, err
+		}
+		p.set(publicKeyEntry{botId: botId, found: false, expiresAt: time.Now().Add(p.negativeTtl)})
+		return nil, false, nil
+	}
+
+	if !publicKey.Valid {
+		p.set(publicKeyEntry{botId: botId, found: false, expiresAt: time.Now().Add(p.negativeTtl)})
+		return nil, false, nil
+	}
+
+	keyBytes, err := hex.DecodeString(publicKey.String)
+	if err != nil {
+		return nil, false, fmt.Errorf("decoding public key for bot %s: %w", botId, err)
+	}
+	if len(keyBytes) != ed25519.PublicKeySize {
+		return nil, false, fmt.Errorf("public key for bot %s is %d bytes, expected %d", botId, len(keyBytes), ed25519.PublicKeySize)
+	}
+
+	key := ed25519.PublicKey(keyBytes)
+	p.set(publicKeyEntry{botId: botId, key: key, found: true, expiresAt: time.Now().Add(p.ttl)})
+
+	return key, true, nil
+}
+
+// Len returns the number of bots with a cached key, including cached misses.
+func (p *PublicKeyCache) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.order.Len()
+}
+
+// Invalidate drops the cached keys of the bots. The local cache is always
+// cleared, an error means other workers may not hear about it until their copy
+// expires.
+func (p *PublicKeyCache) Invalidate(ctx context.Context, botIds ...string) error {
+	p.forget(botIds...)
+
+	if !p.shared {
+		return nil
+	}
+
+	for _, botId := range botIds {
+		if _, err := p.db.ExecContext(ctx, "INSERT INTO public_key_versions (botId) VALUES (?) ON DUPLICATE KEY UPDATE version = version + 1", botId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PublicKeyCache) forget(botIds ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, botId := range botIds {
+		if element, ok := p.entries[botId]; ok {
+			p.order.Remove(element)
+			delete(p.entries, botId)
+		}
+	}
+}
+
+// Poll drops the keys other workers have invalidated since the last poll,
+// returning how many there were. The first poll reads every version so it
+// drops anything cached before it. Polls must not run concurrently.
+func (p *PublicKeyCache) Poll(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	since := p.since
+	p.mu.Unlock()
+
+	var versions []struct {
+		BotId     string    `db:"botId"`
+		Version   int64     `db:"version"`
+		UpdatedAt time.Time `db:"updatedAt"`
+	}
+	if err := p.db.SelectContext(ctx, &versions, "SELECT botId, version, updatedAt FROM public_key_versions WHERE updatedAt >= ? ORDER BY updatedAt", since); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, version := range versions {
+		if seen, ok := p.seen[version.BotId]; ok && seen == version.Version {
+			continue
+		}
+
+		p.forget(version.BotId)
+		changed++
+
+		if version.UpdatedAt.After(since) {
+			since = version.UpdatedAt
+			p.seen = map[string]int64{}
+		}
+		if version.UpdatedAt.Equal(since) {
+			p.seen[version.BotId] = version.Version
+		}
+	}
+
+	p.mu.Lock()
+	p.since = since
+	p.mu.Unlock()
+
+	return changed, nil
+}
+
+// Prune removes expired keys, returning how many were removed.
+func (p *PublicKeyCache) Prune() int {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pruned := 0
+	for botId, element := range p.entries {
+		if now.After(element.Value.(publicKeyEntry).expiresAt) {
+			p.order.Remove(element)
+			delete(p.entries, botId)
+			pruned++
+		}
+	}
+
+	return pruned
+}
+
+// Run prunes the cache and, when it is shared, polls for other workers'
+// invalidations every interval until ctx is cancelled.
+func (p *PublicKeyCache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if p.shared {
+			if changed, err := p.Poll(ctx); err != nil {
+				logger.Error(ctx, "Error polling public key versions", zap.Error(err))
+			} else if changed > 0 {
+				logger.Debug(ctx, "Invalidated public keys changed elsewhere", zap.Int("count", changed))
+			}
+		}
+		p.Prune()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *PublicKeyCache) get(botId string) (publicKeyEntry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	element, ok := p.entries[botId]
+	if !ok {
+		return publicKeyEntry{}, false
+	}
+
+	entry := element.Value.(publicKeyEntry)
+	if time.Now().After(entry.expiresAt) {
+		return publicKeyEntry{}, false
+	}
+
+	p.order.MoveToFront(element)
+	return entry, true
+}
+
+func (p *PublicKeyCache) set(entry publicKeyEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if element, ok := p.entries[entry.botId]; ok {
+		element.Value = entry
+		p.order.MoveToFront(element)
+		return
+	}
+
+	p.entries[entry.botId] = p.order.PushFront(entry)
+
+	for p.order.Len() > p.size {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(publicKeyEntry).botId)
+	}
+}
+
+// NewPublicKeyCache creates a cache of at most size keys. shared should be set
+// when more than one worker uses the database, Run must then be started to
+// hear about the others' changes.
+func NewPublicKeyCache(db *sqlx.DB, size int, ttl time.Duration, negativeTtl time.Duration, shared bool) *PublicKeyCache {
+	return &PublicKeyCache{
+		db:          db,
+		size:        size,
+		ttl:         ttl,
+		negativeTtl: negativeTtl,
+		shared:      shared,
+		entries:     map[string]*list.Element{},
+		order:       list.New(),
+		seen:        map[string]int64{},
+	}
+}
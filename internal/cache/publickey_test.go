@@ -0,0 +1,125 @@
+package cache_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/cache"
+)
+
+func expectMissing(mock sqlmock.Sqlmock, botId string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT publicKey FROM whitelabel_bots WHERE botId = ?")).
+		WithArgs(botId).
+		WillReturnRows(sqlmock.NewRows([]string{"publicKey"}))
+}
+
+func TestPublicKeyCacheBounded(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	defer mockDb.Close()
+
+	var (
+		ctx  = context.Background()
+		keys = cache.NewPublicKeyCache(sqlx.NewDb(mockDb, "mysql"), 2, time.Minute, time.Minute, false)
+		get  = func(botId string) {
+			t.Helper()
+			if _, found, err := keys.Get(ctx, botId); err != nil || found {
+				t.Fatalf("expected bot %s to be missing, got found %t and %v", botId, found, err)
+			}
+		}
+	)
+
+	expectMissing(mock, "1")
+	expectMissing(mock, "2")
+	get("1")
+	get("2")
+	// 1 is used again, so 2 is evicted to make room for 3
+	get("1")
+	expectMissing(mock, "3")
+	get("3")
+	if keys.Len() != 2 {
+		t.Errorf("expected 2 cached keys, got %d", keys.Len())
+	}
+
+	expectMissing(mock, "2")
+	get("2")
+	get("3")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("database expectations: %s", err)
+	}
+}
+
+func TestPublicKeyCachePrune(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	defer mockDb.Close()
+
+	keys := cache.NewPublicKeyCache(sqlx.NewDb(mockDb, "mysql"), cache.DefaultPublicKeySize, time.Minute, time.Millisecond, false)
+
+	expectMissing(mock, "1")
+	if _, _, err := keys.Get(context.Background(), "1"); err != nil {
+		t.Fatalf("getting key: %s", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if pruned := keys.Prune(); pruned != 1 || keys.Len() != 0 {
+		t.Errorf("expected the expired key to be pruned, pruned %d leaving %d", pruned, keys.Len())
+	}
+}
+
+func TestPublicKeyCachePoll(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	defer mockDb.Close()
+
+	var (
+		ctx     = context.Background()
+		keys    = cache.NewPublicKeyCache(sqlx.NewDb(mockDb, "mysql"), cache.DefaultPublicKeySize, time.Minute, time.Minute, true)
+		changed = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		poll    = func(since time.Time, version int64, want int) {
+			t.Helper()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT botId, version, updatedAt FROM public_key_versions WHERE updatedAt >= ? ORDER BY updatedAt")).
+				WithArgs(since).
+				WillReturnRows(sqlmock.NewRows([]string{"botId", "version", "updatedAt"}).AddRow("1", version, changed))
+			if got, err := keys.Poll(ctx); err != nil || got != want {
+				t.Fatalf("expected %d changed keys, got %d and %v", want, got, err)
+			}
+		}
+	)
+
+	expectMissing(mock, "1")
+	if _, _, err := keys.Get(ctx, "1"); err != nil {
+		t.Fatalf("getting key: %s", err)
+	}
+
+	// Another worker set the bot up, the cached miss is dropped
+	poll(time.Time{}, 1, 1)
+	if keys.Len() != 0 {
+		t.Errorf("expected the key to be dropped, %d cached", keys.Len())
+	}
+
+	// The same change is returned again as it was made at the time polled from
+	poll(changed, 1, 0)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO public_key_versions (botId) VALUES (?) ON DUPLICATE KEY UPDATE version = version + 1")).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := keys.Invalidate(ctx, "1"); err != nil {
+		t.Fatalf("invalidating key: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("database expectations: %s", err)
+	}
+}
@@ -0,0 +1,420 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-sql-driver/mysql"
+	"github.com/joho/godotenv"
+)
+
+// Config is loaded from the environment. Values missing from the environment
+// are read from a .env file in the working directory and then from the file
+// named by WORKER_CONFIG_FILE (in the same format), in that order.
+type Config struct {
+	Env           string
+	Port          int
+	WorkerBaseURL string
+	Discord       Discord
+	Database      Database
+	Shutdown      Shutdown
+	Tracing       Tracing
+	Recording     Recording
+	Cache         Cache
+}
+
+type Discord struct {
+	ApplicationId string
+	PublicKey     string
+	BotToken      string
+	DevGuildId    string
+	// MaxTimestampSkew is how far the signed X-Signature-Timestamp of an
+	// interaction may be from our clock before it is rejected as a replay.
+	// Zero disables the check.
+	MaxTimestampSkew time.Duration
+	// CustomIdSecret signs state carried in component custom IDs. When unset
+	// a key is derived from BotToken.
+	CustomIdSecret string
+	// APIBaseURL is where REST API calls are sent, it only needs changing to
+	// point the worker at a stand-in for Discord.
+	APIBaseURL string
+}
+
+type Database struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	// ReplicaHost is a read replica of the database, reads that can be a
+	// little behind go to it when set. It uses the same user and database.
+	ReplicaHost string
+	ReplicaPort int
+	// ReplicaLag is how far behind the replica can be. Cached data that has
+	// just changed is read from the primary for this long.
+	ReplicaLag time.Duration
+	Pool       Pool
+}
+
+// Pool limits the connections kept to each database and how long statements
+// on them can take.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	DialTimeout     time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+}
+
+type Shutdown struct {
+	// DrainDelay is how long to keep serving after a signal while readiness
+	// reports unavailable, giving the load balancer time to stop routing to us.
+	DrainDelay time.Duration
+	// Timeout bounds how long in-flight interactions and background jobs get
+	// to finish once the server has stopped accepting connections.
+	Timeout time.Duration
+}
+
+type Tracing struct {
+	// Backend is one of datadog, otel or none. The OpenTelemetry exporter is
+	// configured through the standard OTEL_EXPORTER_OTLP_* variables.
+	Backend     string
+	ServiceName string
+}
+
+type Recording struct {
+	// Dir is where interactions are recorded for `worker replay`, recording
+	// is off when it is empty.
+	Dir string
+	// Guilds limits recording to these guilds. When empty every guild and DM
+	// is recorded.
+	Guilds []string
+}
+
+type Cache struct {
+	// TTL is how long guild settings and level roles are cached for.
+	TTL time.Duration
+	// PollInterval is how often changes made by other workers are checked
+	// for. Zero turns checking off, which is only safe with a single worker.
+	PollInterval time.Duration
+}
+
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(v, "; ")
+}
+
+func Load() (Config, error) {
+	_ = godotenv.Load()
+
+	if file := os.Getenv("WORKER_CONFIG_FILE"); file != "" {
+		if err := godotenv.Load(file); err != nil {
+			return Config{}, fmt.Errorf("loading %s: %w", file, err)
+		}
+	}
+
+	var errs ValidationError
+
+	cfg := Config{
+		Env:           os.Getenv("ENV"),
+		Port:          intEnv("PORT", 3000, &errs),
+		WorkerBaseURL: os.Getenv("WORKER_BASE_URL"),
+		Discord: Discord{
+			ApplicationId: os.Getenv("DISCORD_APPLICATION_ID"),
+			PublicKey:     os.Getenv("DISCORD_PUBLIC_KEY"),
+			BotToken:      os.Getenv("BOT_TOKEN"),
+			DevGuildId:    os.Getenv("DEVGUILD_ID"),
+
+			MaxTimestampSkew: durationEnv("DISCORD_MAX_TIMESTAMP_SKEW", 30*time.Second, &errs),
+			CustomIdSecret:   os.Getenv("CUSTOM_ID_SECRET"),
+			APIBaseURL:       stringEnv("DISCORD_API_BASE_URL", discordgo.EndpointAPI),
+		},
+		Database: Database{
+			Host:     os.Getenv("DB_HOST"),
+			Port:     intEnv("DB_PORT", 3306, &errs),
+			User:     os.Getenv("DB_USER"),
+			Password: os.Getenv("DB_PASSWORD"),
+			Name:     os.Getenv("DB_NAME"),
+
+			ReplicaHost: os.Getenv("DB_REPLICA_HOST"),
+			ReplicaPort: intEnv("DB_REPLICA_PORT", 0, &errs),
+			ReplicaLag:  durationEnv("DB_REPLICA_LAG", 10*time.Second, &errs),
+			Pool: Pool{
+				MaxOpenConns:    intEnv("DB_MAX_OPEN_CONNS", 25, &errs),
+				MaxIdleConns:    intEnv("DB_MAX_IDLE_CONNS", 10, &errs),
+				ConnMaxLifetime: durationEnv("DB_CONN_MAX_LIFETIME", 5*time.Minute, &errs),
+				ConnMaxIdleTime: durationEnv("DB_CONN_MAX_IDLE_TIME", time.Minute, &errs),
+				DialTimeout:     durationEnv("DB_DIAL_TIMEOUT", 5*time.Second, &errs),
+				ReadTimeout:     durationEnv("DB_READ_TIMEOUT", 30*time.Second, &errs),
+				WriteTimeout:    durationEnv("DB_WRITE_TIMEOUT", 30*time.Second, &errs),
+			},
+		},
+		Shutdown: Shutdown{
+			DrainDelay: durationEnv("SHUTDOWN_DRAIN_DELAY", 5*time.Second, &errs),
+			Timeout:    durationEnv("SHUTDOWN_TIMEOUT", 20*time.Second, &errs),
+		},
+		Tracing: Tracing{
+			Backend:     stringEnv("TRACING_BACKEND", "datadog"),
+			ServiceName: stringEnv("TRACING_SERVICE_NAME", "worker"),
+		},
+		Recording: Recording{
+			Dir:    os.Getenv("RECORD_INTERACTIONS_DIR"),
+			Guilds: listEnv("RECORD_INTERACTIONS_GUILDS"),
+		},
+		Cache: Cache{
+			TTL:          durationEnv("CACHE_TTL", time.Minute, &errs),
+			PollInterval: durationEnv("CACHE_POLL_INTERVAL", 5*time.Second, &errs),
+		},
+	}
+
+	if cfg.Database.ReplicaPort == 0 {
+		cfg.Database.ReplicaPort = cfg.Database.Port
+	}
+
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+
+	return cfg, nil
+}
+
+// Validate checks everything needed to serve interactions.
+func (c Config) Validate() error {
+	var errs ValidationError
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	if c.WorkerBaseURL == "" {
+		errs = append(errs, "WORKER_BASE_URL is required")
+	} else if strings.Contains(c.WorkerBaseURL, "://") || strings.HasSuffix(c.WorkerBaseURL, "/") {
+		errs = append(errs, "WORKER_BASE_URL must be a host without a scheme or trailing slash")
+	}
+	if c.Env != "" && c.Env != "dev" && c.Env != "prod" {
+		errs = append(errs, fmt.Sprintf("ENV must be dev or prod, got %q", c.Env))
+	}
+
+	if c.Shutdown.DrainDelay < 0 || c.Shutdown.Timeout <= 0 {
+		errs = append(errs, "SHUTDOWN_DRAIN_DELAY must not be negative and SHUTDOWN_TIMEOUT must be positive")
+	}
+
+	if c.Cache.TTL <= 0 || c.Cache.PollInterval < 0 {
+		errs = append(errs, "CACHE_TTL must be positive and CACHE_POLL_INTERVAL must not be negative")
+	}
+
+	switch c.Tracing.Backend {
+	case "datadog", "otel", "none":
+	default:
+		errs = append(errs, fmt.Sprintf("TRACING_BACKEND must be datadog, otel or none, got %q", c.Tracing.Backend))
+	}
+
+	for _, guildId := range c.Recording.Guilds {
+		if !isSnowflake(guildId) {
+			errs = append(errs, fmt.Sprintf("RECORD_INTERACTIONS_GUILDS must be a comma separated list of Discord IDs, got %q", guildId))
+		}
+	}
+
+	errs = append(errs, c.Discord.validate()...)
+	errs = append(errs, c.Database.validate()...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// CommandGuildId is the guild commands are registered in, or "" when they are
+// registered globally.
+func (c Config) CommandGuildId() string {
+	if c.Env == "dev" {
+		return c.Discord.DevGuildId
+	}
+	return ""
+}
+
+func (d Discord) Validate() error {
+	if errs := d.validate(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (d Discord) validate() ValidationError {
+	var errs ValidationError
+
+	if !isSnowflake(d.ApplicationId) {
+		errs = append(errs, "DISCORD_APPLICATION_ID must be a Discord ID")
+	}
+	if d.BotToken == "" {
+		errs = append(errs, "BOT_TOKEN is required")
+	}
+	if _, err := d.DecodedPublicKey(); err != nil {
+		errs = append(errs, fmt.Sprintf("DISCORD_PUBLIC_KEY %s", err))
+	}
+	if d.DevGuildId != "" && !isSnowflake(d.DevGuildId) {
+		errs = append(errs, "DEVGUILD_ID must be a Discord ID")
+	}
+	if d.MaxTimestampSkew < 0 {
+		errs = append(errs, "DISCORD_MAX_TIMESTAMP_SKEW must not be negative")
+	}
+	if u, err := url.Parse(d.APIBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.HasSuffix(u.Path, "/") {
+		errs = append(errs, "DISCORD_API_BASE_URL must be an http(s) URL ending in a slash")
+	}
+
+	return errs
+}
+
+func (d Discord) DecodedPublicKey() (ed25519.PublicKey, error) {
+	if d.PublicKey == "" {
+		return nil, fmt.Errorf("is required")
+	}
+
+	key, err := hex.DecodeString(d.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("must be hex encoded")
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+func (d Database) Validate() error {
+	if errs := d.validate(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (d Database) validate() ValidationError {
+	var errs ValidationError
+
+	if d.Host == "" {
+		errs = append(errs, "DB_HOST is required")
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("DB_PORT must be between 1 and 65535, got %d", d.Port))
+	}
+	if d.User == "" {
+		errs = append(errs, "DB_USER is required")
+	}
+	if d.Name == "" {
+		errs = append(errs, "DB_NAME is required")
+	}
+	if d.ReplicaHost != "" && (d.ReplicaPort < 1 || d.ReplicaPort > 65535) {
+		errs = append(errs, fmt.Sprintf("DB_REPLICA_PORT must be between 1 and 65535, got %d", d.ReplicaPort))
+	}
+	if d.ReplicaLag < 0 {
+		errs = append(errs, "DB_REPLICA_LAG must not be negative")
+	}
+
+	if d.Pool.MaxOpenConns < 0 || d.Pool.MaxIdleConns < 0 {
+		errs = append(errs, "DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative")
+	} else if d.Pool.MaxOpenConns > 0 && d.Pool.MaxIdleConns > d.Pool.MaxOpenConns {
+		errs = append(errs, fmt.Sprintf("DB_MAX_IDLE_CONNS must not be more than DB_MAX_OPEN_CONNS (%d), got %d", d.Pool.MaxOpenConns, d.Pool.MaxIdleConns))
+	}
+	if d.Pool.ConnMaxLifetime < 0 || d.Pool.ConnMaxIdleTime < 0 {
+		errs = append(errs, "DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	}
+	if d.Pool.DialTimeout < 0 || d.Pool.ReadTimeout < 0 || d.Pool.WriteTimeout < 0 {
+		errs = append(errs, "DB_DIAL_TIMEOUT, DB_READ_TIMEOUT and DB_WRITE_TIMEOUT must not be negative")
+	}
+
+	return errs
+}
+
+func (d Database) DSN() string {
+	dsn := mysql.NewConfig()
+	dsn.User = d.User
+	dsn.Passwd = d.Password
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	dsn.DBName = d.Name
+	dsn.ParseTime = true
+	dsn.Timeout = d.Pool.DialTimeout
+	dsn.ReadTimeout = d.Pool.ReadTimeout
+	dsn.WriteTimeout = d.Pool.WriteTimeout
+
+	return dsn.FormatDSN()
+}
+
+// Replica returns the settings of the read replica, if there is one.
+func (d Database) Replica() (Database, bool) {
+	if d.ReplicaHost == "" {
+		return Database{}, false
+	}
+
+	replica := d
+	replica.Host = d.ReplicaHost
+	replica.Port = d.ReplicaPort
+	replica.ReplicaHost = ""
+	return replica, true
+}
+
+func stringEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func listEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func intEnv(key string, fallback int, errs *ValidationError) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		*errs = append(*errs, fmt.Sprintf("%s must be a number, got %q", key, value))
+		return fallback
+	}
+
+	return parsed
+}
+
+func durationEnv(key string, fallback time.Duration, errs *ValidationError) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		*errs = append(*errs, fmt.Sprintf("%s must be a duration such as 10s, got %q", key, value))
+		return fallback
+	}
+
+	return parsed
+}
+
+func isSnowflake(value string) bool {
+	if value == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err == nil
+}
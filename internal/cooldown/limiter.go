@@ -0,0 +1,194 @@
+// Package cooldown enforces the cooldowns of limited commands and components.
+// Uses are tracked in memory, so with several workers someone can get a use
+// from each of them per cooldown. That is enough to stop a command from being
+// spammed without adding a database round trip to every interaction.
+package cooldown
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/discord"
+)
+
+const (
+	DefaultOverrideTTL   = time.Minute
+	DefaultPruneInterval = 10 * time.Minute
+
+	// MaxDuration is the longest cooldown a guild can set, uses older than it
+	// are forgotten.
+	MaxDuration = time.Hour
+)
+
+type guildOverrides struct {
+	durations map[string]time.Duration
+	expiresAt time.Time
+}
+
+// Limiter remembers when limited commands were last used. Guild overrides
+// are cached for the TTL given to NewLimiter, changes made through the
+// limiter apply straight away on this worker.
+type Limiter struct {
+	db  *sqlx.DB
+	ttl time.Duration
+
+	mu        sync.Mutex
+	lastUsed  map[string]time.Time
+	overrides map[string]guildOverrides
+}
+
+// Use records the interaction as a use of name, unless name is still cooling
+// down for its scope, in which case nothing is recorded and the time left is
+// returned.
+func (l *Limiter) Use(ctx context.Context, name string, cooldown discord.Cooldown, i discordgo.Interaction) (time.Duration, error) {
+	duration := cooldown.Duration
+
+	if i.GuildID != "" {
+		override, ok, err := l.Override(ctx, i.GuildID, name)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			duration = override
+		}
+	}
+
+	if duration <= 0 {
+		return 0, nil
+	}
+
+	var (
+		key = key(name, cooldown.Scope, i)
+		now = time.Now()
+	)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lastUsed, ok := l.lastUsed[key]; ok {
+		if remaining := lastUsed.Add(duration).Sub(now); remaining > 0 {
+			return remaining, nil
+		}
+	}
+
+	l.lastUsed[key] = now
+	return 0, nil
+}
+
+func key(name string, scope discord.CooldownScope, i discordgo.Interaction) string {
+	switch {
+	case scope == discord.CooldownChannel:
+		return name + " channel " + i.ChannelID
+	case scope == discord.CooldownGuild && i.GuildID != "":
+		return name + " guild " + i.GuildID
+	}
+	return name + " user " + discord.InvokingUserId(i)
+}
+
+// Override returns the cooldown the guild has set for name, if any.
+func (l *Limiter) Override(ctx context.Context, guildId string, name string) (time.Duration, bool, error) {
+	l.mu.Lock()
+	overrides, ok := l.overrides[guildId]
+	l.mu.Unlock()
+
+	if !ok || time.Now().After(overrides.expiresAt) {
+		var rows []struct {
+			Command string `db:"command"`
+			Seconds int    `db:"seconds"`
+		}
+		if err := l.db.SelectContext(ctx, &rows, "SELECT command, seconds FROM command_cooldowns WHERE guildId = ?", guildId); err != nil {
+			return 0, false, err
+		}
+
+		overrides = guildOverrides{durations: map[string]time.Duration{}, expiresAt: time.Now().Add(l.ttl)}
+		for _, row := range rows {
+			overrides.durations[row.Command] = time.Duration(row.Seconds) * time.Second
+		}
+
+		l.mu.Lock()
+		l.overrides[guildId] = overrides
+		l.mu.Unlock()
+	}
+
+	duration, ok := overrides.durations[name]
+	return duration, ok, nil
+}
+
+// SetOverride replaces the cooldown of name in the guild, zero turns it off.
+func (l *Limiter) SetOverride(ctx context.Context, guildId string, name string, duration time.Duration) error {
+	if _, err := l.db.ExecContext(ctx, "INSERT INTO command_cooldowns (guildId, command, seconds) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE seconds = VALUES(seconds)", guildId, name, int(duration/time.Second)); err != nil {
+		return err
+	}
+
+	l.invalidate(guildId)
+	return nil
+}
+
+// ResetOverride goes back to the default cooldown of name in the guild.
+func (l *Limiter) ResetOverride(ctx context.Context, guildId string, name string) error {
+	if _, err := l.db.ExecContext(ctx, "DELETE FROM command_cooldowns WHERE guildId = ? AND command = ?", guildId, name); err != nil {
+		return err
+	}
+
+	l.invalidate(guildId)
+	return nil
+}
+
+func (l *Limiter) invalidate(guildId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.overrides, guildId)
+}
+
+// Prune forgets uses that are past any cooldown and expired overrides,
+// returning how many uses were removed.
+func (l *Limiter) Prune() int {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pruned := 0
+	for key, lastUsed := range l.lastUsed {
+		if now.Sub(lastUsed) > MaxDuration {
+			delete(l.lastUsed, key)
+			pruned++
+		}
+	}
+
+	for guildId, overrides := range l.overrides {
+		if now.After(overrides.expiresAt) {
+			delete(l.overrides, guildId)
+		}
+	}
+
+	return pruned
+}
+
+// Run prunes the limiter every interval until ctx is cancelled.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Prune()
+		}
+	}
+}
+
+func NewLimiter(db *sqlx.DB, overrideTtl time.Duration) *Limiter {
+	return &Limiter{
+		db:        db,
+		ttl:       overrideTtl,
+		lastUsed:  map[string]time.Time{},
+		overrides: map[string]guildOverrides{},
+	}
+}
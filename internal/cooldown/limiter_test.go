@@ -0,0 +1,142 @@
+package cooldown_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bwmarrin/discordgo"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/cooldown"
+	"github.com/prosperitybot/worker/internal/discord"
+)
+
+const overridesQuery = "SELECT command, seconds FROM command_cooldowns WHERE guildId = ?"
+
+func newLimiter(t *testing.T) (*cooldown.Limiter, sqlmock.Sqlmock) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("database expectations: %s", err)
+		}
+		mockDb.Close()
+	})
+
+	return cooldown.NewLimiter(sqlx.NewDb(mockDb, "mysql"), time.Minute), mock
+}
+
+func interaction(guildId string, channelId string, userId string) discordgo.Interaction {
+	return discordgo.Interaction{
+		GuildID:   guildId,
+		ChannelID: channelId,
+		Member:    &discordgo.Member{User: &discordgo.User{ID: userId}},
+	}
+}
+
+func TestUseScopes(t *testing.T) {
+	var (
+		first        = interaction("1", "10", "100")
+		otherUser    = interaction("1", "10", "101")
+		otherChannel = interaction("1", "11", "100")
+		otherGuild   = interaction("2", "20", "100")
+	)
+
+	tests := []struct {
+		scope discord.CooldownScope
+		// limited is whether each of otherUser, otherChannel and otherGuild
+		// share the first interaction's cooldown.
+		limited [3]bool
+	}{
+		{discord.CooldownUser, [3]bool{false, true, true}},
+		{discord.CooldownChannel, [3]bool{true, false, false}},
+		{discord.CooldownGuild, [3]bool{true, true, false}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.scope), func(t *testing.T) {
+			limiter, mock := newLimiter(t)
+			mock.ExpectQuery(regexp.QuoteMeta(overridesQuery)).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"command", "seconds"}))
+			mock.ExpectQuery(regexp.QuoteMeta(overridesQuery)).WithArgs("2").WillReturnRows(sqlmock.NewRows([]string{"command", "seconds"}))
+
+			c := discord.Cooldown{Scope: tt.scope, Duration: time.Minute}
+
+			if remaining, err := limiter.Use(context.Background(), "level", c, first); err != nil || remaining != 0 {
+				t.Fatalf("expected the first use to be allowed, got %s, %v", remaining, err)
+			}
+			if remaining, _ := limiter.Use(context.Background(), "level", c, first); remaining <= 0 || remaining > time.Minute {
+				t.Errorf("expected the same interaction to be limited, got %s", remaining)
+			}
+
+			for n, i := range []discordgo.Interaction{otherUser, otherChannel, otherGuild} {
+				remaining, err := limiter.Use(context.Background(), "level", c, i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if limited := remaining > 0; limited != tt.limited[n] {
+					t.Errorf("interaction %d: expected limited to be %t", n, tt.limited[n])
+				}
+			}
+
+			// Other commands have their own cooldown
+			if remaining, _ := limiter.Use(context.Background(), "leaderboard", c, first); remaining != 0 {
+				t.Errorf("expected another command to be allowed, got %s", remaining)
+			}
+		})
+	}
+}
+
+func TestUseInDM(t *testing.T) {
+	limiter, _ := newLimiter(t)
+
+	var (
+		c  = discord.Cooldown{Scope: discord.CooldownGuild, Duration: time.Minute}
+		dm = discordgo.Interaction{ChannelID: "10", User: &discordgo.User{ID: "100"}}
+	)
+
+	limiter.Use(context.Background(), "level", c, dm)
+
+	other := dm
+	other.User = &discordgo.User{ID: "101"}
+	if remaining, _ := limiter.Use(context.Background(), "level", c, other); remaining != 0 {
+		t.Errorf("expected guild cooldowns to be per user in DMs, got %s", remaining)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	limiter, mock := newLimiter(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(overridesQuery)).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"command", "seconds"}).AddRow("level", 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO command_cooldowns (guildId, command, seconds) VALUES (?, ?, ?)")).
+		WithArgs("1", "level", 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(overridesQuery)).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"command", "seconds"}).AddRow("level", 0))
+
+	var (
+		c = discord.Cooldown{Scope: discord.CooldownUser, Duration: time.Minute}
+		i = interaction("1", "10", "100")
+	)
+
+	limiter.Use(context.Background(), "level", c, i)
+	if remaining, _ := limiter.Use(context.Background(), "level", c, i); remaining <= 0 || remaining > time.Second {
+		t.Errorf("expected the guild's 1 second cooldown to apply, got %s", remaining)
+	}
+
+	if err := limiter.SetOverride(context.Background(), "1", "level", 0); err != nil {
+		t.Fatalf("setting override: %s", err)
+	}
+
+	// The change applies straight away, even to uses already recorded
+	if remaining, _ := limiter.Use(context.Background(), "level", c, i); remaining != 0 {
+		t.Errorf("expected the cooldown to be off, got %s", remaining)
+	}
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// DB is the primary database, which everything is written to, and the
+// database reads that can be a little behind go to. Without a read replica
+// they are the same.
+type DB struct {
+	Writer *sqlx.DB
+	Reader *sqlx.DB
+}
+
+// Replicated reports whether reads go to a replica.
+func (d DB) Replicated() bool {
+	return d.Reader != d.Writer
+}
+
+func (d DB) Close() error {
+	if !d.Replicated() {
+		return d.Writer.Close()
+	}
+	writerErr, readerErr := d.Writer.Close(), d.Reader.Close()
+	if writerErr != nil {
+		return writerErr
+	}
+	return readerErr
+}
+
+// NewDB reads from reader, or writer when reader is nil.
+func NewDB(writer *sqlx.DB, reader *sqlx.DB) DB {
+	if reader == nil {
+		reader = writer
+	}
+	return DB{Writer: writer, Reader: reader}
+}
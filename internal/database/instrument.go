@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+type QueryEvent struct {
+	// Operation is one of query, exec, prepare, begin, commit or rollback.
+	Operation string
+	Query     string
+	Start     time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// Hook is called after every statement sent through a wrapped driver.
+type Hook func(ctx context.Context, event QueryEvent)
+
+// WrapDriver returns a driver that calls hooks for each statement run on its
+// connections. Calls the underlying driver skips (driver.ErrSkip) are not
+// reported, database/sql retries those through a prepared statement which is.
+func WrapDriver(d driver.Driver, hooks ...Hook) driver.Driver {
+	return &instrumentedDriver{Driver: d, hooks: hooks}
+}
+
+type instrumentedDriver struct {
+	driver.Driver
+	hooks []Hook
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, hooks: d.hooks}, nil
+}
+
+func report(ctx context.Context, hooks []Hook, operation string, query string, start time.Time, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+
+	event := QueryEvent{
+		Operation: operation,
+		Query:     query,
+		Start:     start,
+		Duration:  time.Since(start),
+		Err:       err,
+	}
+
+	for _, hook := range hooks {
+		hook(ctx, event)
+	}
+}
+
+type instrumentedConn struct {
+	driver.Conn
+	hooks []Hook
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		start = time.Now()
+		stmt  driver.Stmt
+		err   error
+	)
+
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	report(ctx, c.hooks, "prepare", query, start, err)
+
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query, hooks: c.hooks}, nil
+}
+
+func (c *instrumentedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var (
+		start = time.Now()
+		tx    driver.Tx
+		err   error
+	)
+
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	report(ctx, c.hooks, "begin", "", start, err)
+
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx, ctx: ctx, hooks: c.hooks}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	report(ctx, c.hooks, "exec", query, start, err)
+
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	report(ctx, c.hooks, "query", query, start, err)
+
+	return rows, err
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+	hooks []Hook
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var (
+		start  = time.Now()
+		result driver.Result
+		err    error
+	)
+
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(namedValuesToValues(args))
+	}
+	report(ctx, s.hooks, "exec", s.query, start, err)
+
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var (
+		start = time.Now()
+		rows  driver.Rows
+		err   error
+	)
+
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValuesToValues(args))
+	}
+	report(ctx, s.hooks, "query", s.query, start, err)
+
+	return rows, err
+}
+
+type instrumentedTx struct {
+	driver.Tx
+	ctx   context.Context
+	hooks []Hook
+}
+
+func (t *instrumentedTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	report(t.ctx, t.hooks, "commit", "", start, err)
+	return err
+}
+
+func (t *instrumentedTx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	report(t.ctx, t.hooks, "rollback", "", start, err)
+	return err
+}
+
+func namedValuesToValues(named []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(named))
+	for i := range named {
+		values[i] = named[i].Value
+	}
+	return values
+}
@@ -1,11 +1,11 @@
 package command
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/model"
 	"github.com/prosperitybot/common/utils"
@@ -26,17 +26,27 @@ func (m AboutCommand) Command() discordgo.ApplicationCommand {
 	}
 }
 
-func (m AboutCommand) Execute(c echo.Context, i discordgo.Interaction) {
+func (m AboutCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
 	var (
-		aboutStats model.AboutStats
+		aboutStats   model.AboutStats
+		guildId      = i.GuildID
+		guildMembers int
 	)
 
 	if err := m.db.Get(&aboutStats, "SELECT (SELECT COUNT(id) FROM guilds WHERE active = true) AS servers, COUNT(DISTINCT guildId, userId) AS users FROM guild_users"); err != nil {
-		logger.Error(c.Request().Context(), "failed to get about stats", zap.Error(err))
-		utils.SendResponse(c, "Failed to load the about command", true, true)
+		logger.Error(ctx, "failed to get about stats", zap.Error(err))
+		r.Error("Failed to load the about command")
 		return
 	}
 
+	if guildId != "" {
+		if err := m.db.GetContext(ctx, &guildMembers, "SELECT COUNT(*) FROM guild_users WHERE guildId = ?", guildId); err != nil {
+			logger.Error(ctx, "failed to get guild member count for about", zap.Error(err))
+			r.Error("Failed to load the about command")
+			return
+		}
+	}
+
 	responseMsg := "Prosperity is a levelling bot ready to skill up and boost up your Discord server. We pride ourselves on openness, transparency and collaboration	"
 	embed := utils.CreateEmbed(&discordgo.MessageEmbed{
 		Description: responseMsg,
@@ -49,7 +59,16 @@ func (m AboutCommand) Execute(c echo.Context, i discordgo.Interaction) {
 		},
 	}, false)
 
-	utils.SendComplexResponse(c, discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{embed}})
+	// Outside of a server (DMs and user installs) only the bot-wide statistics make sense
+	if guildId != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "This Server",
+			Value:  fmt.Sprintf("Members: %d", guildMembers),
+			Inline: true,
+		})
+	}
+
+	r.Respond(discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{embed}})
 }
 
 func NewAboutCommand(db *sqlx.DB) AboutCommand {
@@ -0,0 +1,968 @@
+package command_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/common/model"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/command"
+	"github.com/prosperitybot/worker/internal/discord/component"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest/resttest"
+	it "github.com/prosperitybot/worker/internal/interactiontest"
+	"github.com/prosperitybot/worker/internal/rank"
+)
+
+const (
+	otherUserId = "500000000000000005"
+	roleId      = "600000000000000006"
+	otherRoleId = "600000000000000016"
+	botId       = "700000000000000007"
+	botToken    = "main-bot-token"
+)
+
+var guildUserColumns = []string{"guildId", "userId", "level", "xp", "messageCount"}
+
+func setup(env it.Env) (map[string]discord.SlashCommand, map[string]discord.Component) {
+	var (
+		db         = env.DB
+		publicKeys = cache.NewPublicKeyCache(db, cache.DefaultPublicKeySize, cache.DefaultPublicKeyTTL, cache.DefaultPublicKeyNegativeTTL, false)
+		registrar  = register.NewRegistrar(db, env.Discord, "")
+		ranks      = rank.NewService(db, rank.DefaultTotalTTL)
+	)
+
+	commands := map[string]discord.SlashCommand{
+		"about":       command.NewAboutCommand(db),
+		"ignored":     command.NewIgnoredCommand(db),
+		"leaderboard": command.NewLeaderboardCommand(ranks, component.NewLeaderboardPageComponent(ranks, env.CustomIds)),
+		"level":       command.NewLevelCommand(db, ranks),
+		"levelroles":  command.NewLevelRolesCommand(db, env.Store, env.Discord.WithToken(botToken), env.Jobs),
+		"levels":      command.NewLevelsCommand(db),
+		"whitelabel":  command.NewWhitelabelCommand(db, publicKeys, registrar, env.Discord, env.Jobs, "worker.example"),
+		"xp":          command.NewXpCommand(db),
+	}
+	commands["settings"] = command.NewSettingsCommand(db, env.Store, component.NewSettingsNotificationComponent(db, env.Store), env.Cooldowns, discord.Cooldowns(commands))
+
+	return commands, map[string]discord.Component{}
+}
+
+func query(sql string) string {
+	return regexp.QuoteMeta(sql)
+}
+
+func expectGuildUser(mock sqlmock.Sqlmock, userId string, level int, xp int) {
+	mock.ExpectQuery(query("SELECT * FROM guild_users WHERE guildId = ? AND userId = ?")).
+		WithArgs(it.GuildId, userId).
+		WillReturnRows(sqlmock.NewRows(guildUserColumns).AddRow(it.GuildId, userId, level, xp, 10))
+}
+
+func expectExists(mock sqlmock.Sqlmock, sql string, exists bool, args ...driver.Value) {
+	mock.ExpectQuery(query(sql)).
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+}
+
+func TestAbout(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name:        "in a server",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("about") },
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT (SELECT COUNT(id) FROM guilds WHERE active = true) AS servers")).
+					WillReturnRows(sqlmock.NewRows([]string{"servers", "users"}).AddRow(12, 3400))
+				mock.ExpectQuery(query("SELECT COUNT(*) FROM guild_users WHERE guildId = ?")).
+					WithArgs(it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(56))
+			},
+			Want: "Prosperity is a levelling bot",
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				fields := response.Data.Embeds[0].Fields
+				if len(fields) != 2 || fields[0].Value != "Servers: 12\nMembers: 3400" || fields[1].Value != "Members: 56" {
+					t.Errorf("unexpected fields %+v", fields)
+				}
+			},
+		},
+		{
+			Name:        "in a DM",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return it.InDM(h.Command("about")) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT (SELECT COUNT(id) FROM guilds WHERE active = true) AS servers")).
+					WillReturnRows(sqlmock.NewRows([]string{"servers", "users"}).AddRow(12, 3400))
+			},
+			Want: "Prosperity is a levelling bot",
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				if fields := response.Data.Embeds[0].Fields; len(fields) != 1 {
+					t.Errorf("expected only the bot statistics, got %+v", fields)
+				}
+			},
+		},
+	})
+}
+
+func TestIgnored(t *testing.T) {
+	const (
+		channelExists = "SELECT EXISTS(SELECT 1 FROM ignored_channels WHERE id = ? AND guildId = ?)"
+		roleExists    = "SELECT EXISTS(SELECT 1 FROM ignored_roles WHERE id = ? AND guildId = ?)"
+	)
+
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "add channel",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("ignored", it.SubCommandGroup("channels", it.SubCommand("add", it.Channel("channel", it.ChannelId))))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, channelExists, false, it.ChannelId, it.GuildId)
+				mock.ExpectExec(query("INSERT INTO ignored_channels (id, guildId) VALUES (?, ?)")).
+					WithArgs(it.ChannelId, it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "<#" + it.ChannelId + "> will be ignored from gaining xp",
+		},
+		{
+			Name: "add channel already ignored",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("ignored", it.SubCommandGroup("channels", it.SubCommand("add", it.Channel("channel", it.ChannelId))))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, channelExists, true, it.ChannelId, it.GuildId)
+			},
+			Want:      "is already being ignored",
+			Ephemeral: true,
+		},
+		{
+			Name: "remove channel",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("ignored", it.SubCommandGroup("channels", it.SubCommand("remove", it.Channel("channel", it.ChannelId))))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, channelExists, true, it.ChannelId, it.GuildId)
+				mock.ExpectExec(query("DELETE FROM ignored_channels WHERE id = ? AND guildId = ?")).
+					WithArgs(it.ChannelId, it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "will no longer be ignored from gaining xp",
+		},
+		{
+			Name: "list channels",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("ignored", it.SubCommandGroup("channels", it.SubCommand("list")))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT id FROM ignored_channels WHERE guildId = ?")).
+					WithArgs(it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(it.ChannelId))
+			},
+			Want: "**Ignored Channels**\n\n- <#" + it.ChannelId + ">",
+		},
+		{
+			Name: "add role",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("ignored", it.SubCommandGroup("roles", it.SubCommand("add", it.Role("role", roleId))))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, roleExists, false, roleId, it.GuildId)
+				mock.ExpectExec(query("INSERT INTO ignored_roles (id, guildId) VALUES (?, ?)")).
+					WithArgs(roleId, it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "<@&" + roleId + "> will be ignored from gaining xp",
+		},
+		{
+			Name: "remove role not ignored",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("ignored", it.SubCommandGroup("roles", it.SubCommand("remove", it.Role("role", roleId))))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, roleExists, false, roleId, it.GuildId)
+			},
+			Want:      "is not being ignored",
+			Ephemeral: true,
+		},
+		{
+			Name: "list roles",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("ignored", it.SubCommandGroup("roles", it.SubCommand("list")))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT id FROM ignored_roles WHERE guildId = ?")).
+					WithArgs(it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(roleId))
+			},
+			Want: "**Ignored Roles**\n\n- <@&" + roleId + ">",
+		},
+	})
+}
+
+func expectMemberCount(mock sqlmock.Sqlmock, count int) {
+	mock.ExpectQuery(query("SELECT COUNT(*) FROM guild_users WHERE guildId = ?")).
+		WithArgs(it.GuildId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func TestLeaderboard(t *testing.T) {
+	const page = "SELECT gu.userId, gu.level, gu.xp"
+
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name:        "first page",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("leaderboard") },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectMemberCount(mock, 20)
+				mock.ExpectQuery(query(page)).
+					WithArgs(it.GuildId, 10, 0, it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"userId", "level", "xp", "username"}).
+						AddRow(it.UserId, 5, 900, "tester").
+						AddRow(otherUserId, 3, 400, "other"))
+			},
+			Want: "Top 10 Members (Page 1 of 2)\n\n 1. tester - Level 5\n2. other - Level 3",
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				previous, next := pageButtons(t, response)
+				if !previous.Disabled || next.Disabled {
+					t.Errorf("expected only next to be enabled, got %+v and %+v", previous, next)
+				}
+
+				_, values, err := h.CustomIds.Decode(next.CustomID)
+				if err != nil {
+					t.Fatalf("decoding next button id %q: %s", next.CustomID, err)
+				}
+				if strings.Join(values, " ") != "next 2 400 "+otherUserId {
+					t.Errorf("expected next to page on from the last member, got %v", values)
+				}
+			},
+		},
+		{
+			Name:        "second page",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("leaderboard", it.Integer("page", 2)) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectMemberCount(mock, 20)
+				mock.ExpectQuery(query(page)).
+					WithArgs(it.GuildId, 10, 10, it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"userId", "level", "xp", "username"}).
+						AddRow(otherUserId, 1, 50, "other"))
+			},
+			Want: "11. other - Level 1",
+		},
+		{
+			Name:        "past the last page",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("leaderboard", it.Integer("page", 3)) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectMemberCount(mock, 20)
+			},
+			Want:      "The leaderboard only has 2 pages",
+			Ephemeral: true,
+		},
+		{
+			Name:        "past the furthest page",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("leaderboard", it.Integer("page", 101)) },
+			Want:        "Only the first 100 pages can be jumped to, use the buttons to go further",
+			Ephemeral:   true,
+		},
+		{
+			Name:        "only one page",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("leaderboard") },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectMemberCount(mock, 1)
+				mock.ExpectQuery(query(page)).
+					WithArgs(it.GuildId, 10, 0, it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"userId", "level", "xp", "username"}).
+						AddRow(it.UserId, 5, 900, "tester"))
+			},
+			Want: "Top 10 Members (Page 1 of 1)",
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				if len(response.Data.Components) != 0 {
+					t.Errorf("expected no buttons, got %+v", response.Data.Components)
+				}
+			},
+		},
+	})
+}
+
+func TestLeaderboardIsGuildOnly(t *testing.T) {
+	h := it.New(t, setup)
+
+	response := h.Respond(it.InDM(h.Command("leaderboard")))
+
+	if want := "/leaderboard can only be used in a server"; it.Description(response) != want {
+		t.Errorf("expected %q, got %q", want, it.Description(response))
+	}
+}
+
+func TestLevel(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name:        "own level",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("level") },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, it.UserId, 2, 150)
+				expectRank(mock, it.UserId, 150, 41)
+				expectMemberCount(mock, 3120)
+			},
+			Want: "Your current level is **2**\nYou need **325** xp to get to the next level\nRank #42 of 3,120",
+		},
+		{
+			Name:        "another user",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("level", it.User("user", otherUserId)) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, otherUserId, 4, 600)
+				expectRank(mock, otherUserId, 600, 0)
+				expectMemberCount(mock, 7)
+			},
+			Want: "<@" + otherUserId + ">'s current level is **4**",
+		},
+		{
+			Name:        "without a rank",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("level") },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, it.UserId, 2, 150)
+				mock.ExpectQuery(query("SELECT COUNT(*) FROM guild_users WHERE guildId = ? AND (xp > ?")).
+					WillReturnError(errors.New("connection refused"))
+			},
+			Want: "You need **325** xp to get to the next level",
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				if strings.Contains(it.Description(response), "Rank") {
+					t.Errorf("expected no rank, got %q", it.Description(response))
+				}
+			},
+		},
+		{
+			Name:        "user that has never talked",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("level", it.User("user", otherUserId)) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT * FROM guild_users WHERE guildId = ? AND userId = ?")).
+					WithArgs(it.GuildId, otherUserId).
+					WillReturnRows(sqlmock.NewRows(guildUserColumns))
+			},
+			Want:      "<@" + otherUserId + "> has never talked before",
+			Ephemeral: true,
+		},
+		{
+			Name:        "in a DM",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return it.InDM(h.Command("level")) },
+			Want:        "Levels are tracked separately in every server",
+			Ephemeral:   true,
+		},
+	})
+}
+
+const (
+	levelRoleExists   = "SELECT exists(SELECT 1 FROM level_roles WHERE guildId = ? AND (level = ? OR id = ?))"
+	levelRoleIdExists = "SELECT exists(SELECT 1 FROM level_roles WHERE guildId = ? AND id = ?)"
+)
+
+func expectLevelRoles(mock sqlmock.Sqlmock, levelRoles ...model.LevelRole) {
+	rows := sqlmock.NewRows([]string{"id", "guildId", "level"})
+	for _, levelRole := range levelRoles {
+		rows.AddRow(levelRole.Id, it.GuildId, levelRole.Level)
+	}
+
+	mock.ExpectQuery(query("SELECT * FROM level_roles WHERE guildId = ? ORDER BY level")).
+		WithArgs(it.GuildId).
+		WillReturnRows(rows)
+}
+
+func expectUsersNeedingRole(userIds ...string) func(mock sqlmock.Sqlmock) {
+	return func(mock sqlmock.Sqlmock) {
+		rows := sqlmock.NewRows([]string{"userId"})
+		for _, userId := range userIds {
+			rows.AddRow(userId)
+		}
+
+		expectExists(mock, levelRoleExists, false, it.GuildId, 5, roleId)
+		mock.ExpectExec(query("INSERT INTO level_roles (guildId, level, id, createdAt, updatedAt)")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(query("SELECT userId FROM guild_users WHERE guildId = ? AND level >= ?")).
+			WithArgs(it.GuildId, 5, it.GuildId, 5).
+			WillReturnRows(rows)
+	}
+}
+
+func expectDeferred(t *testing.T, response discordgo.InteractionResponse) {
+	t.Helper()
+
+	if response.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Errorf("expected a deferred response, got type %d", response.Type)
+	}
+}
+
+// expectEdit checks the interaction's response was edited once to a message
+// containing want.
+func expectEdit(t *testing.T, h *it.Harness, want string) {
+	t.Helper()
+
+	edits := h.Edits()
+	if len(edits) != 1 {
+		t.Fatalf("expected the response to be edited once, got %d edits", len(edits))
+	}
+	if description := it.EditDescription(edits[0]); !strings.Contains(description, want) {
+		t.Errorf("expected the response to be edited to contain %q, got %q", want, description)
+	}
+}
+
+func TestLevelRoles(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "add",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("add", it.Role("role", roleId), it.Integer("level", 5)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, levelRoleExists, false, it.GuildId, 5, roleId)
+				mock.ExpectExec(query("INSERT INTO level_roles (guildId, level, id, createdAt, updatedAt)")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("SELECT userId FROM guild_users WHERE guildId = ? AND level >= ?")).
+					WithArgs(it.GuildId, 5, it.GuildId, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"userId"}))
+			},
+			Want: "<@&" + roleId + "> will be granted at level **5**\n\nAssigning role to **0** users",
+		},
+		{
+			Name: "add assigns the role",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("add", it.Role("role", roleId), it.Integer("level", 5)))
+			},
+			Expect: expectUsersNeedingRole(it.UserId, otherUserId),
+			Discord: func(server *resttest.Server) {
+				server.Respond(http.MethodPut, memberRole(it.UserId), http.StatusNoContent, nil)
+				server.Respond(http.MethodPut, memberRole(otherUserId), http.StatusNoContent, nil)
+			},
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				expectDeferred(t, response)
+				expectEdit(t, h, "<@&"+roleId+"> will be granted at level **5**\n\nAssigned role to **2** users")
+
+				calls := h.Discord.CallsTo(http.MethodPut, memberRole(otherUserId))
+				if len(calls) != 1 || calls[0].Header.Get("Authorization") != "Bot "+botToken {
+					t.Errorf("expected the role to be added as the main bot, got %+v", calls)
+				}
+			},
+		},
+		{
+			Name: "add waits out rate limits",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("add", it.Role("role", roleId), it.Integer("level", 5)))
+			},
+			Expect: expectUsersNeedingRole(it.UserId, otherUserId),
+			Discord: func(server *resttest.Server) {
+				server.RateLimit(http.MethodPut, memberRole(it.UserId), 10*time.Millisecond, 1)
+				server.Respond(http.MethodPut, memberRole(it.UserId), http.StatusNoContent, nil)
+				server.Respond(http.MethodPut, memberRole(otherUserId), http.StatusNoContent, nil)
+			},
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				expectDeferred(t, response)
+				expectEdit(t, h, "Assigned role to **2** users")
+			},
+		},
+		{
+			Name: "add carries on when a member can't be given the role",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("add", it.Role("role", roleId), it.Integer("level", 5)))
+			},
+			Expect: expectUsersNeedingRole(it.UserId, otherUserId),
+			Discord: func(server *resttest.Server) {
+				server.Respond(http.MethodPut, memberRole(otherUserId), http.StatusNoContent, nil)
+			},
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				expectEdit(t, h, "Assigned role to **1** of **2** users, **1** failed")
+			},
+		},
+		{
+			Name: "add without permission to assign the role",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("add", it.Role("role", roleId), it.Integer("level", 5)))
+			},
+			Expect: expectUsersNeedingRole(it.UserId, otherUserId),
+			Discord: func(server *resttest.Server) {
+				server.Forbid(http.MethodPut, memberRole(it.UserId))
+			},
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				expectEdit(t, h, "Error adding role to users, assigned to **0** of **2** users")
+
+				if calls := h.Discord.CallsTo(http.MethodPut, memberRole(otherUserId)); len(calls) != 0 {
+					t.Errorf("expected assigning to stop at the first missing permission, got %d more calls", len(calls))
+				}
+			},
+		},
+		{
+			Name: "add existing",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("add", it.Role("role", roleId), it.Integer("level", 5)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, levelRoleExists, true, it.GuildId, 5, roleId)
+			},
+			Want:      "Level role already exists",
+			Ephemeral: true,
+		},
+		{
+			Name: "remove missing",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("remove", it.Role("role", roleId)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, levelRoleIdExists, false, it.GuildId, roleId)
+			},
+			Want:      "Level role does not exist",
+			Ephemeral: true,
+		},
+		{
+			Name: "remove",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levelroles", it.SubCommand("remove", it.Role("role", roleId)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, levelRoleIdExists, true, it.GuildId, roleId)
+				mock.ExpectExec(query("DELETE FROM level_roles WHERE id = ?")).
+					WithArgs(roleId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "<@&" + roleId + "> has been removed as a level role",
+		},
+		{
+			Name:        "list",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("levelroles", it.SubCommand("list")) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectLevelRoles(mock, model.LevelRole{Id: roleId, Level: 5})
+			},
+			Want: "- <@&" + roleId + "> at level **5**",
+		},
+	})
+}
+
+func TestLevels(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "give",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levels", it.SubCommand("give", it.User("user", otherUserId), it.Integer("levels", 2)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, otherUserId, 3, 400)
+				mock.ExpectExec(query("UPDATE guild_users SET level = ?, xp = ? WHERE guildId = ? AND userId = ?")).
+					WithArgs(5, sqlmock.AnyArg(), it.GuildId, otherUserId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "Given **2** level(s) to <@" + otherUserId + ">",
+		},
+		{
+			Name: "take",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levels", it.SubCommand("take", it.User("user", otherUserId), it.Integer("levels", 1)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, otherUserId, 3, 400)
+				mock.ExpectExec(query("UPDATE guild_users SET level = ?, xp = ? WHERE guildId = ? AND userId = ?")).
+					WithArgs(2, sqlmock.AnyArg(), it.GuildId, otherUserId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "Taken **1** level(s) from <@" + otherUserId + ">",
+		},
+		{
+			Name: "take below zero",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("levels", it.SubCommand("take", it.User("user", otherUserId), it.Integer("levels", 4)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, otherUserId, 3, 400)
+			},
+			Want:      "User level cannot be less than 0",
+			Ephemeral: true,
+		},
+	})
+}
+
+func expectCooldownOverrides(mock sqlmock.Sqlmock, overrides map[string]int) {
+	rows := sqlmock.NewRows([]string{"command", "seconds"})
+	for command, seconds := range overrides {
+		rows.AddRow(command, seconds)
+	}
+
+	mock.ExpectQuery(query("SELECT command, seconds FROM command_cooldowns WHERE guildId = ?")).
+		WithArgs(it.GuildId).
+		WillReturnRows(rows)
+}
+
+func TestCooldowns(t *testing.T) {
+	h := it.New(t, setup, it.WithCooldowns())
+
+	expectCooldownOverrides(h.Mock, nil)
+	expectGuildUser(h.Mock, it.UserId, 2, 150)
+	expectGuildUser(h.Mock, otherUserId, 4, 600)
+
+	if response := h.Respond(h.Command("level")); it.Ephemeral(response) {
+		t.Fatalf("expected the first use to be allowed, got %q", it.Description(response))
+	}
+
+	response := h.Respond(h.Command("level"))
+	if description := it.Description(response); !it.Ephemeral(response) || description != "This is on cooldown, try again in 5s" {
+		t.Errorf("expected the second use to be turned away, got %q", description)
+	}
+
+	// The cooldown of /level is per user
+	if response := h.Respond(it.SentBy(h.Command("level"), otherUserId)); it.Ephemeral(response) {
+		t.Errorf("expected another user to be allowed, got %q", it.Description(response))
+	}
+}
+
+func TestCooldownOverride(t *testing.T) {
+	h := it.New(t, setup, it.WithCooldowns())
+
+	expectCooldownOverrides(h.Mock, map[string]int{"level": 0})
+	expectGuildUser(h.Mock, it.UserId, 2, 150)
+	expectGuildUser(h.Mock, it.UserId, 2, 150)
+
+	for n := 0; n < 2; n++ {
+		if response := h.Respond(h.Command("level")); it.Ephemeral(response) {
+			t.Errorf("expected use %d to be allowed with the cooldown turned off, got %q", n+1, it.Description(response))
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "cooldown",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("cooldown", it.String("command", "level"), it.Integer("seconds", 30)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("INSERT INTO command_cooldowns (guildId, command, seconds) VALUES (?, ?, ?)")).
+					WithArgs(it.GuildId, "level", 30).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Set the cooldown of `/level` to `30` seconds",
+			Ephemeral: true,
+		},
+		{
+			Name: "cooldown off",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("cooldown", it.String("command", "leaderboard"), it.Integer("seconds", 0)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("INSERT INTO command_cooldowns (guildId, command, seconds) VALUES (?, ?, ?)")).
+					WithArgs(it.GuildId, "leaderboard", 0).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Turned off the cooldown of `/leaderboard`",
+			Ephemeral: true,
+		},
+		{
+			Name: "cooldown reset",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("cooldown", it.String("command", "level")))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("DELETE FROM command_cooldowns WHERE guildId = ? AND command = ?")).
+					WithArgs(it.GuildId, "level").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Set the cooldown of `/level` back to the default of `5` seconds",
+			Ephemeral: true,
+		},
+		{
+			Name: "cooldown of a command without one",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("cooldown", it.String("command", "settings"), it.Integer("seconds", 5)))
+			},
+			Want:      "/settings does not have a cooldown",
+			Ephemeral: true,
+		},
+		{
+			Name: "notifications channel",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("notifications", it.Channel("channel", it.ChannelId)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("UPDATE guilds SET notificationType = ?, notificationChannel = ? WHERE id = ?")).
+					WithArgs("channel", it.ChannelId, it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Set the notifications channel to <#" + it.ChannelId + ">",
+			Ephemeral: true,
+		},
+		{
+			Name: "notifications menu",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("notifications"))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT * FROM guilds WHERE id = ?")).
+					WithArgs(it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "notificationType"}).AddRow(it.GuildId, "dm"))
+			},
+			Ephemeral: true,
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				if got := selected(selectMenu(t, response)); got != "settings::notifications::dm" {
+					t.Errorf("expected the current notification type to be selected, got %q", got)
+				}
+			},
+		},
+		{
+			Name: "notifications menu without settings",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("notifications"))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT * FROM guilds WHERE id = ?")).
+					WithArgs(it.GuildId).
+					WillReturnError(errors.New("connection refused"))
+			},
+			Ephemeral: true,
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				if got := selected(selectMenu(t, response)); got != "" {
+					t.Errorf("expected nothing to be selected, got %q", got)
+				}
+			},
+		},
+		{
+			Name: "roles",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("roles", it.String("type", "stack")))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("UPDATE guilds SET roleAssignType = ? WHERE id = ?")).
+					WithArgs("stack", it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Set the role assignment type to `stack`",
+			Ephemeral: true,
+		},
+		{
+			Name: "multiplier",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("multiplier", it.Number("multiplier", 1.5)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("UPDATE guilds SET xpRate = ? WHERE id = ?")).
+					WithArgs(1.5, it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Set the XP multiplier to `1.500000`",
+			Ephemeral: true,
+		},
+		{
+			Name: "delay",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("delay", it.Integer("delay", 30)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("UPDATE guilds SET xpDelay = ? WHERE id = ?")).
+					WithArgs(30, it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Set the XP delay to `30`",
+			Ephemeral: true,
+		},
+		{
+			Name: "invalid options",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("settings", it.SubCommand("delay", it.String("delay", "soon")))
+			},
+			Want:      "The options given to this command were not valid",
+			Ephemeral: true,
+		},
+	})
+}
+
+func TestWhitelabel(t *testing.T) {
+	const isPremium = "SELECT exists (SELECT 1 FROM users WHERE id = ? AND premium_status = true)"
+
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "not premium",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("whitelabel", it.SubCommand("setup", it.String("token", "token"), it.String("public_key", "key")))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, isPremium, false, it.UserId)
+			},
+			Want:      "You are not a whitelabel client",
+			Ephemeral: true,
+		},
+		{
+			Name: "setup",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("whitelabel", it.SubCommand("setup", it.String("token", "whitelabel-token"), it.String("public_key", "key")))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, isPremium, true, it.UserId)
+				expectExists(mock, "SELECT exists (SELECT 1 FROM whitelabel_bots WHERE userId = ?)", false, it.UserId)
+				mock.ExpectExec(query("INSERT INTO whitelabel_bots")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Discord: func(server *resttest.Server) {
+				server.Respond(http.MethodGet, "users/@me", http.StatusOK, discordgo.User{ID: botId, Username: "Levels", Discriminator: "0001"})
+				server.Respond(http.MethodGet, "applications/"+botId+"/commands", http.StatusOK, []discordgo.ApplicationCommand{})
+			},
+			Ephemeral: true,
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				expectDeferred(t, response)
+				expectEdit(t, h, "`https://worker.example/interactions/"+botId+"`")
+
+				calls := h.Discord.CallsTo(http.MethodGet, "users/@me")
+				if len(calls) != 1 || calls[0].Header.Get("Authorization") != "Bot whitelabel-token" {
+					t.Errorf("expected the bot to be looked up with its own token, got %+v", calls)
+				}
+			},
+		},
+		{
+			Name: "setup with an invalid token",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("whitelabel", it.SubCommand("setup", it.String("token", "whitelabel-token"), it.String("public_key", "key")))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, isPremium, true, it.UserId)
+			},
+			Discord: func(server *resttest.Server) {
+				server.Respond(http.MethodGet, "users/@me", http.StatusUnauthorized, map[string]any{"message": "401: Unauthorized", "code": 0})
+			},
+			Ephemeral: true,
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				expectDeferred(t, response)
+				expectEdit(t, h, "Invalid bot token")
+			},
+		},
+		{
+			Name:        "actions",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("whitelabel", it.SubCommand("actions")) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, isPremium, true, it.UserId)
+				mock.ExpectQuery(query("SELECT * FROM whitelabel_bots WHERE userId = ?")).
+					WithArgs(it.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"botId", "userId", "botName", "botDiscrim", "last_action"}).
+						AddRow(botId, it.UserId, "Levels", "0001", "start"))
+			},
+			Want:      "Please select a bot below",
+			Ephemeral: true,
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				menu := selectMenu(t, response)
+				if menu.CustomID != "whitelabel::botselection" || len(menu.Options) != 1 || menu.Options[0].Value != botId {
+					t.Errorf("unexpected bot selection menu %+v", menu)
+				}
+			},
+		},
+		{
+			Name:        "actions without bots",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Command("whitelabel", it.SubCommand("actions")) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectExists(mock, isPremium, true, it.UserId)
+				mock.ExpectQuery(query("SELECT * FROM whitelabel_bots WHERE userId = ?")).
+					WithArgs(it.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"botId"}))
+			},
+			Want:      "You don't have any whitelabel bots",
+			Ephemeral: true,
+		},
+	})
+}
+
+func TestXp(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "give",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("xp", it.SubCommand("give", it.User("user", otherUserId), it.Integer("xp", 50)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, otherUserId, 3, 400)
+				mock.ExpectExec(query("UPDATE guild_users SET level = ?, xp = ? WHERE guildId = ? AND userId = ?")).
+					WithArgs(sqlmock.AnyArg(), 450, it.GuildId, otherUserId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "Given **50** xp to <@" + otherUserId + ">",
+		},
+		{
+			Name: "take",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("xp", it.SubCommand("take", it.User("user", otherUserId), it.Integer("levels", 50)))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				expectGuildUser(mock, otherUserId, 3, 400)
+				mock.ExpectExec(query("UPDATE guild_users SET level = ?, xp = ? WHERE guildId = ? AND userId = ?")).
+					WithArgs(sqlmock.AnyArg(), 350, it.GuildId, otherUserId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want: "Taken **50** xp from <@" + otherUserId + ">",
+		},
+		{
+			Name: "unsupported subcommand",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Command("xp", it.SubCommand("reset", it.User("user", otherUserId)))
+			},
+			Want:      "This command is not supported",
+			Ephemeral: true,
+		},
+	})
+}
+
+func memberRole(userId string) string {
+	return "guilds/" + it.GuildId + "/members/" + userId + "/roles/" + roleId
+}
+
+func expectRank(mock sqlmock.Sqlmock, userId string, xp int, above int) {
+	mock.ExpectQuery(query("SELECT COUNT(*) FROM guild_users WHERE guildId = ? AND (xp > ? OR (xp = ? AND userId < ?))")).
+		WithArgs(it.GuildId, xp, xp, userId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(above))
+}
+
+func pageButtons(t *testing.T, response discordgo.InteractionResponse) (discordgo.Button, discordgo.Button) {
+	t.Helper()
+
+	if response.Data == nil || len(response.Data.Components) != 1 {
+		t.Fatalf("expected one action row, got %+v", response.Data)
+	}
+
+	row, ok := response.Data.Components[0].(*discordgo.ActionsRow)
+	if !ok || len(row.Components) != 2 {
+		t.Fatalf("expected an action row with two buttons, got %+v", response.Data.Components[0])
+	}
+
+	previous, ok := row.Components[0].(*discordgo.Button)
+	if !ok {
+		t.Fatalf("expected a button, got %T", row.Components[0])
+	}
+	next, ok := row.Components[1].(*discordgo.Button)
+	if !ok {
+		t.Fatalf("expected a button, got %T", row.Components[1])
+	}
+
+	return *previous, *next
+}
+
+func selectMenu(t *testing.T, response discordgo.InteractionResponse) discordgo.SelectMenu {
+	t.Helper()
+
+	if response.Data == nil || len(response.Data.Components) != 1 {
+		t.Fatalf("expected one action row, got %+v", response.Data)
+	}
+
+	row, ok := response.Data.Components[0].(*discordgo.ActionsRow)
+	if !ok || len(row.Components) != 1 {
+		t.Fatalf("expected an action row with one component, got %+v", response.Data.Components[0])
+	}
+
+	menu, ok := row.Components[0].(*discordgo.SelectMenu)
+	if !ok {
+		t.Fatalf("expected a select menu, got %T", row.Components[0])
+	}
+
+	return *menu
+}
+
+// selected returns the value of the menu's default option.
+func selected(menu discordgo.SelectMenu) string {
+	for _, option := range menu.Options {
+		if option.Default {
+			return option.Value
+		}
+	}
+	return ""
+}
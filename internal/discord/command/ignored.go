@@ -1,21 +1,29 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
-	"github.com/prosperitybot/common/utils"
 	"github.com/prosperitybot/worker/internal/discord"
 	"go.uber.org/zap"
 )
 
 type IgnoredCommand struct {
 	discord.SlashCommand
-	db *sqlx.DB
+	db     *sqlx.DB
+	router discord.Router
+}
+
+type ignoredChannelOptions struct {
+	Channel string `option:"channel"`
+}
+
+type ignoredRoleOptions struct {
+	Role string `option:"role"`
 }
 
 func (m IgnoredCommand) Command() discordgo.ApplicationCommand {
@@ -110,90 +118,70 @@ func (m IgnoredCommand) Command() discordgo.ApplicationCommand {
 	}
 }
 
-func (m IgnoredCommand) Execute(c echo.Context, i discordgo.Interaction) {
-	subCommand := i.ApplicationCommandData().Options[0]
-
-	switch subCommand.Name {
-	case "channels":
-		m.subcmd_channels(c, i, subCommand)
-	case "roles":
-		m.subcmd_roles(c, i, subCommand)
-	}
-}
-
-func (m IgnoredCommand) subcmd_channels(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
-	subSubCommand := subCommand.Options[0]
-
-	switch subSubCommand.Name {
-	case "add":
-		m.subcmd_channels_add(c, i, subSubCommand)
-	case "remove":
-		m.subcmd_channels_remove(c, i, subSubCommand)
-	case "list":
-		m.subcmd_channels_list(c, i, subSubCommand)
-	}
+func (m IgnoredCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	m.router.Execute(ctx, r, i)
 }
 
-func (m IgnoredCommand) subcmd_channels_add(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m IgnoredCommand) subcmd_channels_add(ctx context.Context, r discord.Responder, i discordgo.Interaction, options ignoredChannelOptions) {
 	var (
-		channelId     = subCommand.Options[0].ChannelValue(nil).ID
+		channelId     = options.Channel
 		alreadyExists = false
 	)
 
 	if err := m.db.Get(&alreadyExists, "SELECT EXISTS(SELECT 1 FROM ignored_channels WHERE id = ? AND guildId = ?)", channelId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether channel is already ignored", zap.Error(err))
-		utils.SendResponse(c, "Could not check whether channel is already ignored", true, true)
+		logger.Error(ctx, "Error whilst checking whether channel is already ignored", zap.Error(err))
+		r.Error("Could not check whether channel is already ignored")
 		return
 	}
 
 	if alreadyExists {
-		utils.SendResponse(c, fmt.Sprintf("<#%s> is already being ignored", channelId), true, true)
+		r.Error(fmt.Sprintf("<#%s> is already being ignored", channelId))
 		return
 	}
 
 	if _, err := m.db.Exec("INSERT INTO ignored_channels (id, guildId) VALUES (?, ?)", channelId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst adding channel to ignored list", zap.Error(err))
-		utils.SendResponse(c, "Could not add channel to ignored list", true, true)
+		logger.Error(ctx, "Error whilst adding channel to ignored list", zap.Error(err))
+		r.Error("Could not add channel to ignored list")
 		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("<#%s> will be ignored from gaining xp", channelId), false, false)
+	r.Reply(fmt.Sprintf("<#%s> will be ignored from gaining xp", channelId))
 }
 
-func (m IgnoredCommand) subcmd_channels_remove(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m IgnoredCommand) subcmd_channels_remove(ctx context.Context, r discord.Responder, i discordgo.Interaction, options ignoredChannelOptions) {
 	var (
-		channelId     = subCommand.Options[0].ChannelValue(nil).ID
+		channelId     = options.Channel
 		alreadyExists = false
 	)
 
 	if err := m.db.Get(&alreadyExists, "SELECT EXISTS(SELECT 1 FROM ignored_channels WHERE id = ? AND guildId = ?)", channelId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether channel is already ignored", zap.Error(err))
-		utils.SendResponse(c, "Could not check whether channel is already ignored", true, true)
+		logger.Error(ctx, "Error whilst checking whether channel is already ignored", zap.Error(err))
+		r.Error("Could not check whether channel is already ignored")
 		return
 	}
 
 	if !alreadyExists {
-		utils.SendResponse(c, fmt.Sprintf("<#%s> is not being ignored", channelId), true, true)
+		r.Error(fmt.Sprintf("<#%s> is not being ignored", channelId))
 		return
 	}
 
 	if _, err := m.db.Exec("DELETE FROM ignored_channels WHERE id = ? AND guildId = ?", channelId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst removing channel from ignored list", zap.Error(err))
-		utils.SendResponse(c, "Could not remove channel from ignored list", true, true)
+		logger.Error(ctx, "Error whilst removing channel from ignored list", zap.Error(err))
+		r.Error("Could not remove channel from ignored list")
 		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("<#%s> will no longer be ignored from gaining xp", channelId), false, false)
+	r.Reply(fmt.Sprintf("<#%s> will no longer be ignored from gaining xp", channelId))
 }
 
-func (m IgnoredCommand) subcmd_channels_list(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m IgnoredCommand) subcmd_channels_list(ctx context.Context, r discord.Responder, i discordgo.Interaction, options struct{}) {
 	var (
 		channelIds []string
 	)
 
-	if err := m.db.SelectContext(c.Request().Context(), &channelIds, "SELECT id FROM ignored_channels WHERE guildId = ?", i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst getting list of ignored channels", zap.Error(err))
-		utils.SendResponse(c, "Error getting ignored channels", true, true)
+	if err := m.db.SelectContext(ctx, &channelIds, "SELECT id FROM ignored_channels WHERE guildId = ?", i.GuildID); err != nil {
+		logger.Error(ctx, "Error whilst getting list of ignored channels", zap.Error(err))
+		r.Error("Error getting ignored channels")
 		return
 	}
 
@@ -203,82 +191,69 @@ func (m IgnoredCommand) subcmd_channels_list(c echo.Context, i discordgo.Interac
 		ignoredChannelStrings[i] = fmt.Sprintf("- <#%s>", channelIds[i])
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("**Ignored Channels**\n\n%s", strings.Join(ignoredChannelStrings, "\n")), false, false)
-}
-
-func (m IgnoredCommand) subcmd_roles(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
-	subSubCommand := subCommand.Options[0]
-
-	switch subSubCommand.Name {
-	case "add":
-		m.subcmd_roles_add(c, i, subSubCommand)
-	case "remove":
-		m.subcmd_roles_remove(c, i, subSubCommand)
-	case "list":
-		m.subcmd_roles_list(c, i, subSubCommand)
-	}
+	r.Reply(fmt.Sprintf("**Ignored Channels**\n\n%s", strings.Join(ignoredChannelStrings, "\n")))
 }
 
-func (m IgnoredCommand) subcmd_roles_add(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m IgnoredCommand) subcmd_roles_add(ctx context.Context, r discord.Responder, i discordgo.Interaction, options ignoredRoleOptions) {
 	var (
-		roleId        = subCommand.Options[0].RoleValue(nil, "").ID
+		roleId        = options.Role
 		alreadyExists = false
 	)
 
 	if err := m.db.Get(&alreadyExists, "SELECT EXISTS(SELECT 1 FROM ignored_roles WHERE id = ? AND guildId = ?)", roleId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether role is already ignored", zap.Error(err))
-		utils.SendResponse(c, "Could not check whether role is already ignored", true, true)
+		logger.Error(ctx, "Error whilst checking whether role is already ignored", zap.Error(err))
+		r.Error("Could not check whether role is already ignored")
 		return
 	}
 
 	if alreadyExists {
-		utils.SendResponse(c, fmt.Sprintf("<@&%s> is already being ignored", roleId), true, true)
+		r.Error(fmt.Sprintf("<@&%s> is already being ignored", roleId))
 		return
 	}
 
 	if _, err := m.db.Exec("INSERT INTO ignored_roles (id, guildId) VALUES (?, ?)", roleId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst adding role to ignored list", zap.Error(err))
-		utils.SendResponse(c, "Could not add role to ignored list", true, true)
+		logger.Error(ctx, "Error whilst adding role to ignored list", zap.Error(err))
+		r.Error("Could not add role to ignored list")
 		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("<@&%s> will be ignored from gaining xp", roleId), false, false)
+	r.Reply(fmt.Sprintf("<@&%s> will be ignored from gaining xp", roleId))
 }
 
-func (m IgnoredCommand) subcmd_roles_remove(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m IgnoredCommand) subcmd_roles_remove(ctx context.Context, r discord.Responder, i discordgo.Interaction, options ignoredRoleOptions) {
 	var (
-		roleId        = subCommand.Options[0].RoleValue(nil, "").ID
+		roleId        = options.Role
 		alreadyExists = false
 	)
 
 	if err := m.db.Get(&alreadyExists, "SELECT EXISTS(SELECT 1 FROM ignored_roles WHERE id = ? AND guildId = ?)", roleId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether role is already ignored", zap.Error(err))
-		utils.SendResponse(c, "Could not check whether role is already ignored", true, true)
+		logger.Error(ctx, "Error whilst checking whether role is already ignored", zap.Error(err))
+		r.Error("Could not check whether role is already ignored")
 		return
 	}
 
 	if !alreadyExists {
-		utils.SendResponse(c, fmt.Sprintf("<@&%s> is not being ignored", roleId), true, true)
+		r.Error(fmt.Sprintf("<@&%s> is not being ignored", roleId))
 		return
 	}
 
 	if _, err := m.db.Exec("DELETE FROM ignored_roles WHERE id = ? AND guildId = ?", roleId, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst removing role from ignored list", zap.Error(err))
-		utils.SendResponse(c, "Could not remove role from ignored list", true, true)
+		logger.Error(ctx, "Error whilst removing role from ignored list", zap.Error(err))
+		r.Error("Could not remove role from ignored list")
 		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("<@&%s> will no longer be ignored from gaining xp", roleId), false, false)
+	r.Reply(fmt.Sprintf("<@&%s> will no longer be ignored from gaining xp", roleId))
 }
 
-func (m IgnoredCommand) subcmd_roles_list(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m IgnoredCommand) subcmd_roles_list(ctx context.Context, r discord.Responder, i discordgo.Interaction, options struct{}) {
 	var (
 		roleIds []string
 	)
 
-	if err := m.db.SelectContext(c.Request().Context(), &roleIds, "SELECT id FROM ignored_roles WHERE guildId = ?", i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst getting list of ignored roles", zap.Error(err))
-		utils.SendResponse(c, "Error getting ignored roles", true, true)
+	if err := m.db.SelectContext(ctx, &roleIds, "SELECT id FROM ignored_roles WHERE guildId = ?", i.GuildID); err != nil {
+		logger.Error(ctx, "Error whilst getting list of ignored roles", zap.Error(err))
+		r.Error("Error getting ignored roles")
 		return
 	}
 
@@ -288,9 +263,23 @@ func (m IgnoredCommand) subcmd_roles_list(c echo.Context, i discordgo.Interactio
 		ignoredRoleStrings[i] = fmt.Sprintf("- <@&%s>", roleIds[i])
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("**Ignored Roles**\n\n%s", strings.Join(ignoredRoleStrings, "\n")), false, false)
+	r.Reply(fmt.Sprintf("**Ignored Roles**\n\n%s", strings.Join(ignoredRoleStrings, "\n")))
+}
+
+func (m IgnoredCommand) Mutates(i discordgo.Interaction) bool {
+	path := discord.SubCommandPath(i)
+	return len(path) > 0 && path[len(path)-1] != "list"
 }
 
 func NewIgnoredCommand(db *sqlx.DB) IgnoredCommand {
-	return IgnoredCommand{db: db}
+	m := IgnoredCommand{db: db, router: discord.NewRouter()}
+
+	discord.Handle(m.router, "channels add", m.subcmd_channels_add)
+	discord.Handle(m.router, "channels remove", m.subcmd_channels_remove)
+	discord.Handle(m.router, "channels list", m.subcmd_channels_list)
+	discord.Handle(m.router, "roles add", m.subcmd_roles_add)
+	discord.Handle(m.router, "roles remove", m.subcmd_roles_remove)
+	discord.Handle(m.router, "roles list", m.subcmd_roles_list)
+
+	return m
 }
@@ -1,80 +1,115 @@
 package command
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
-	"github.com/prosperitybot/common/model"
-	"github.com/prosperitybot/common/utils"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/component"
+	"github.com/prosperitybot/worker/internal/rank"
 	"go.uber.org/zap"
 )
 
+// maxLeaderboardPage is the furthest page that can be asked for, as every
+// page before it is counted past. The buttons page on from there by XP.
+const maxLeaderboardPage = 100
+
+type leaderboardOptions struct {
+	Page *int `option:"page"`
+}
+
 type LeaderboardCommand struct {
 	discord.SlashCommand
-	db *sqlx.DB
+	ranks *rank.Service
+	pages component.LeaderboardPageComponent
 }
 
 func (m LeaderboardCommand) Command() discordgo.ApplicationCommand {
+	var (
+		dmAccess bool = false
+		minPage       = float64(1)
+		maxPage       = float64(maxLeaderboardPage)
+	)
 	return discordgo.ApplicationCommand{
-		Name:        "leaderboard",
-		Type:        discordgo.ChatApplicationCommand,
-		Description: "Displays the top users and their levels",
+		Name:         "leaderboard",
+		Type:         discordgo.ChatApplicationCommand,
+		Description:  "Displays the top users and their levels",
+		DMPermission: &dmAccess,
 		Options: []*discordgo.ApplicationCommandOption{
 			{
 				Name:        "page",
 				Type:        discordgo.ApplicationCommandOptionInteger,
-				Description: "The page you want to display",
+				Description: fmt.Sprintf("The page you want to display, up to %d (use the buttons to go further)", maxLeaderboardPage),
 				Required:    false,
+				MinValue:    &minPage,
+				MaxValue:    maxPage,
 			},
 		},
 	}
 }
 
-func (m LeaderboardCommand) Execute(c echo.Context, i discordgo.Interaction) {
+func (m LeaderboardCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
 	var (
-		page             = 1
-		pageSize         = 10
-		guildId          = i.GuildID
-		guildUsers       []model.GuildUser
-		userCount        int
-		leaderboardLines []string
-		offset           = pageSize * (page - 1)
+		page    = 1
+		guildId = i.GuildID
 	)
 
-	if len(i.ApplicationCommandData().Options) > 0 {
-		page = int(i.ApplicationCommandData().Options[0].IntValue())
-		offset = pageSize * (page - 1)
+	options, err := discord.Bind[leaderboardOptions](i.ApplicationCommandData().Options)
+	if err != nil {
+		logger.Error(ctx, "Error reading command options", zap.Error(err))
+		r.Error("The options given to this command were not valid")
+		return
+	}
+	if options.Page != nil {
+		page = *options.Page
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > maxLeaderboardPage {
+		r.Error(fmt.Sprintf("Only the first %d pages can be jumped to, use the buttons to go further", maxLeaderboardPage))
+		return
 	}
 
-	if err := m.db.GetContext(c.Request().Context(), &userCount, "SELECT COUNT(*) FROM guild_users WHERE guildId = ?", guildId); err != nil {
-		logger.Error(c.Request().Context(), "Error getting amount of users in guild for leaderboard", zap.Error(err))
-		utils.SendResponse(c, "Could not fetch leaderboard", true, true)
+	userCount, err := m.ranks.Total(ctx, guildId)
+	if err != nil {
+		logger.Error(ctx, "Error getting amount of users in guild for leaderboard", zap.Error(err))
+		r.Error("Could not fetch leaderboard")
 		return
 	}
 
-	leaderboardQuery := `SELECT gu.*, IF(u.discriminator = '0', u.username, CONCAT(u.username, "#", u.discriminator)) AS username FROM guild_users gu INNER JOIN users u ON gu.userId = u.id WHERE guildId = ? ORDER BY xp DESC LIMIT %d OFFSET %d`
-	leaderboardQuery = fmt.Sprintf(leaderboardQuery, pageSize, offset)
+	if pages := (userCount + component.LeaderboardPageSize - 1) / component.LeaderboardPageSize; page > 1 && page > pages {
+		r.Error(fmt.Sprintf("The leaderboard only has %d pages", pages))
+		return
+	}
 
-	if err := m.db.SelectContext(c.Request().Context(), &guildUsers, leaderboardQuery, guildId); err != nil {
-		logger.Error(c.Request().Context(), "Error getting list of users for the leaderboard", zap.Error(err))
-		utils.SendResponse(c, "Error getting leaderboard", true, true)
+	members, err := m.ranks.Page(ctx, guildId, page, component.LeaderboardPageSize)
+	if err != nil {
+		logger.Error(ctx, "Error getting list of users for the leaderboard", zap.Error(err))
+		r.Error("Error getting leaderboard")
 		return
 	}
 
-	for i := range guildUsers {
-		userIndex := i + 1 + offset
-		leaderboardLines = append(leaderboardLines, fmt.Sprintf("%d. %s - Level %d", userIndex, guildUsers[i].Username, guildUsers[i].Level))
+	data, err := m.pages.Message(page, userCount, members)
+	if err != nil {
+		logger.Error(ctx, "Error whilst building leaderboard buttons", zap.Error(err))
+		r.Error("Error getting leaderboard")
+		return
 	}
-	responseMsg := fmt.Sprintf("Top 10 Members (Page %d of %d)\n\n %s", page, userCount/pageSize, strings.Join(leaderboardLines, "\n"))
 
-	utils.SendResponse(c, responseMsg, false, false)
+	r.Respond(data)
+}
+
+// Cooldown is per channel as the leaderboard is posted for everyone to see.
+func (m LeaderboardCommand) Cooldown() discord.Cooldown {
+	return discord.Cooldown{Scope: discord.CooldownChannel, Duration: 10 * time.Second}
 }
 
-func NewLeaderboardCommand(db *sqlx.DB) LeaderboardCommand {
-	return LeaderboardCommand{db: db}
+// NewLeaderboardCommand shows pages of the leaderboard with buttons handled
+// by pages.
+func NewLeaderboardCommand(ranks *rank.Service, pages component.LeaderboardPageComponent) LeaderboardCommand {
+	return LeaderboardCommand{ranks: ranks, pages: pages}
 }
@@ -1,22 +1,29 @@
 package command
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/model"
 	"github.com/prosperitybot/common/utils"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/rank"
 	"go.uber.org/zap"
 )
 
+type levelOptions struct {
+	User *string `option:"user"`
+}
+
 type LevelCommand struct {
 	discord.SlashCommand
-	db *sqlx.DB
+	db    *sqlx.DB
+	ranks *rank.Service
 }
 
 func (m LevelCommand) Command() discordgo.ApplicationCommand {
@@ -35,25 +42,37 @@ func (m LevelCommand) Command() discordgo.ApplicationCommand {
 	}
 }
 
-func (m LevelCommand) Execute(c echo.Context, i discordgo.Interaction) {
+func (m LevelCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
 	var (
-		userId  = i.Member.User.ID
-		guildId = i.GuildID
+		invokerId = discord.InvokingUserId(i)
+		userId    = invokerId
+		guildId   = i.GuildID
 	)
 
-	if len(i.ApplicationCommandData().Options) > 0 {
-		userId = i.ApplicationCommandData().Options[0].UserValue(nil).ID
+	if guildId == "" {
+		r.Ephemeral("Levels are tracked separately in every server, use /level in a server to see your level there")
+		return
+	}
+
+	options, err := discord.Bind[levelOptions](i.ApplicationCommandData().Options)
+	if err != nil {
+		logger.Error(ctx, "Error reading command options", zap.Error(err))
+		r.Error("The options given to this command were not valid")
+		return
+	}
+	if options.User != nil {
+		userId = *options.User
 	}
 
 	var guildUser model.GuildUser
 
 	if err := m.db.Get(&guildUser, "SELECT * FROM guild_users WHERE guildId = ? AND userId = ?", guildId, userId); err != nil {
 		if err == sql.ErrNoRows {
-			utils.SendResponse(c, fmt.Sprintf("<@%s> has never talked before", userId), true, true)
+			r.Error(fmt.Sprintf("<@%s> has never talked before", userId))
 			return
 		}
-		logger.Error(c.Request().Context(), "Error whilst getting user level", zap.Error(err))
-		utils.SendResponse(c, "Error getting guild user", true, true)
+		logger.Error(ctx, "Error whilst getting user level", zap.Error(err))
+		r.Error("Error getting guild user")
 		return
 	}
 
@@ -62,13 +81,24 @@ func (m LevelCommand) Execute(c echo.Context, i discordgo.Interaction) {
 		responseMsg = fmt.Sprintf("Your current level is **%d**\nYou need **%d** xp to get to the next level", guildUser.Level, xpNeeded)
 	)
 
-	if userId != i.Member.User.ID {
+	if userId != invokerId {
 		responseMsg = fmt.Sprintf("<@%s>'s current level is **%d**\nThey need **%d** xp to get to the next level", userId, guildUser.Level, xpNeeded)
 	}
 
-	utils.SendResponse(c, responseMsg, false, false)
+	// The level is still worth showing without the rank
+	if position, err := m.ranks.Rank(ctx, guildId, userId, guildUser.Xp); err != nil {
+		logger.Error(ctx, "Error whilst getting user rank", zap.Error(err))
+	} else {
+		responseMsg += "\n" + position.String()
+	}
+
+	r.Reply(responseMsg)
+}
+
+func (m LevelCommand) Cooldown() discord.Cooldown {
+	return discord.Cooldown{Scope: discord.CooldownUser, Duration: 5 * time.Second}
 }
 
-func NewLevelCommand(db *sqlx.DB) LevelCommand {
-	return LevelCommand{db: db}
+func NewLevelCommand(db *sqlx.DB, ranks *rank.Service) LevelCommand {
+	return LevelCommand{db: db, ranks: ranks}
 }
@@ -1,23 +1,40 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/model"
-	"github.com/prosperitybot/common/utils"
+	"github.com/prosperitybot/worker/internal/background"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/store"
 	"go.uber.org/zap"
 )
 
 type LevelRolesCommand struct {
 	discord.SlashCommand
-	db *sqlx.DB
+	db      *sqlx.DB
+	store   *store.Store
+	discord rest.Client
+	jobs    *background.Runner
+	router  discord.Router
+}
+
+type levelRolesAddOptions struct {
+	Role  string `option:"role"`
+	Level int    `option:"level"`
+}
+
+type levelRolesRemoveOptions struct {
+	Role string `option:"role"`
 }
 
 func (m LevelRolesCommand) Command() discordgo.ApplicationCommand {
@@ -75,34 +92,26 @@ func (m LevelRolesCommand) Command() discordgo.ApplicationCommand {
 	}
 }
 
-func (m LevelRolesCommand) Execute(c echo.Context, i discordgo.Interaction) {
-	subCommand := i.ApplicationCommandData().Options[0]
-
-	switch subCommand.Name {
-	case "add":
-		m.subcmd_add(c, i, subCommand)
-	case "remove":
-		m.subcmd_remove(c, i, subCommand)
-	case "list":
-		m.subcmd_list(c, i, subCommand)
-	}
+func (m LevelRolesCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	m.router.Execute(ctx, r, i)
 }
 
-func (m LevelRolesCommand) subcmd_add(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m LevelRolesCommand) subcmd_add(ctx context.Context, r discord.Responder, i discordgo.Interaction, options levelRolesAddOptions) {
 	var (
-		role          = subCommand.Options[0].RoleValue(nil, i.GuildID).ID
-		level         = int(subCommand.Options[1].IntValue())
+		role          = options.Role
+		level         = options.Level
 		alreadyExists = false
 	)
 
-	if err := m.db.GetContext(c.Request().Context(), &alreadyExists, "SELECT exists(SELECT 1 FROM level_roles WHERE guildId = ? AND (level = ? OR id = ?))", i.GuildID, level, role); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether levelrole exists", zap.Error(err))
-		utils.SendResponse(c, "Error getting level roles", true, true)
+	// Checked on the primary rather than the cache, which can be behind
+	if err := m.db.GetContext(ctx, &alreadyExists, "SELECT exists(SELECT 1 FROM level_roles WHERE guildId = ? AND (level = ? OR id = ?))", i.GuildID, level, role); err != nil {
+		logger.Error(ctx, "Error whilst checking whether levelrole exists", zap.Error(err))
+		r.Error("Error getting level roles")
 		return
 	}
 
 	if alreadyExists {
-		utils.SendResponse(c, "Level role already exists", true, true)
+		r.Error("Level role already exists")
 		return
 	}
 
@@ -114,70 +123,123 @@ func (m LevelRolesCommand) subcmd_add(c echo.Context, i discordgo.Interaction, s
 		UpdatedAt: time.Now().UTC(),
 	}
 
-	if _, err := m.db.NamedExecContext(c.Request().Context(), "INSERT INTO level_roles (guildId, level, id, createdAt, updatedAt) VALUES (:guildId, :level, :id, :createdAt, :updatedAt)", levelRole); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst creating the new levelrole", zap.Error(err))
-		utils.SendResponse(c, "Error adding level role", true, true)
+	if _, err := m.db.NamedExecContext(ctx, "INSERT INTO level_roles (guildId, level, id, createdAt, updatedAt) VALUES (:guildId, :level, :id, :createdAt, :updatedAt)", levelRole); err != nil {
+		logger.Error(ctx, "Error whilst creating the new levelrole", zap.Error(err))
+		r.Error("Error adding level role")
 		return
 	}
+	m.invalidate(ctx, i.GuildID)
 
 	var usersNeedingRole []string
 	usersNeedingRoleQuery := "SELECT userId FROM guild_users WHERE guildId = ? AND level >= ? AND level < COALESCE((SELECT level FROM level_roles WHERE guildId = ? AND level > ? ORDER BY level ASC LIMIT 1), 9999)"
 
-	if err := m.db.SelectContext(c.Request().Context(), &usersNeedingRole, usersNeedingRoleQuery, i.GuildID, level, i.GuildID, level); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst getting a list of users to assign the level role to", zap.Error(err))
-		utils.SendResponse(c, "Error getting list of users to apply the role to", true, true)
+	if err := m.db.SelectContext(ctx, &usersNeedingRole, usersNeedingRoleQuery, i.GuildID, level, i.GuildID, level); err != nil {
+		logger.Error(ctx, "Error whilst getting a list of users to assign the level role to", zap.Error(err))
+		r.Error("Error getting list of users to apply the role to")
 		return
 	}
 
-	for _, userId := range usersNeedingRole {
-		if err := levelRole.AddToMember(userId, fmt.Sprintf("New level role added (Level %d)", level)); err != nil {
-			logger.Error(c.Request().Context(), "Error whilst adding the role", zap.String("roleId", levelRole.Id), zap.String("userToAdd", userId), zap.Error(err))
-			utils.SendResponse(c, "Error adding role to users", true, true)
-			return
-		}
+	responseMsg := fmt.Sprintf("<@&%s> will be granted at level **%d**", role, level)
+
+	if len(usersNeedingRole) == 0 {
+		r.Reply(responseMsg + "\n\nAssigning role to **0** users")
+		return
 	}
 
-	responseMsg := fmt.Sprintf("<@&%s> will be granted at level **%d**\n\nAssigning role to **%d** users", role, level, len(usersNeedingRole))
+	// Every member is a separate request, so large guilds can take longer
+	// than Discord waits for a response
+	if err := r.Defer(false); err != nil {
+		logger.Error(ctx, "Error whilst deferring the response", zap.Error(err))
+		return
+	}
+
+	m.jobs.Go("levelrole-assign", func(jobCtx context.Context) {
+		assigned, failed, err := m.assignRole(jobCtx, i.GuildID, role, level, usersNeedingRole)
+
+		var edit discordgo.WebhookEdit
+		switch {
+		case err != nil && jobCtx.Err() != nil:
+			edit = discord.MessageEdit(fmt.Sprintf("%s\n\nAssigning the role was interrupted, assigned to **%d** of **%d** users", responseMsg, assigned, len(usersNeedingRole)), true)
+		case err != nil:
+			edit = discord.MessageEdit(fmt.Sprintf("%s\n\nError adding role to users, assigned to **%d** of **%d** users. Make sure I can manage the role.", responseMsg, assigned, len(usersNeedingRole)), true)
+		case failed > 0:
+			edit = discord.MessageEdit(fmt.Sprintf("%s\n\nAssigned role to **%d** of **%d** users, **%d** failed", responseMsg, assigned, len(usersNeedingRole), failed), false)
+		default:
+			edit = discord.MessageEdit(fmt.Sprintf("%s\n\nAssigned role to **%d** users", responseMsg, assigned), false)
+		}
+
+		editCtx, cancel := context.WithTimeout(context.Background(), discord.EditTimeout)
+		defer cancel()
 
-	utils.SendResponse(c, responseMsg, false, false)
+		if err := r.EditOriginal(editCtx, edit); err != nil {
+			logger.Error(jobCtx, "Error whilst editing the level role response", zap.String("guildId", i.GuildID), zap.String("roleId", role), zap.Error(err))
+		}
+	})
 }
 
-func (m LevelRolesCommand) subcmd_remove(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+// assignRole gives the role to every user, carrying on past individual
+// failures. It stops with an error when the bot isn't allowed to assign the
+// role or ctx is cancelled, as every other request would fail too.
+func (m LevelRolesCommand) assignRole(ctx context.Context, guildId string, role string, level int, userIds []string) (int, int, error) {
 	var (
-		role          = subCommand.Options[0].RoleValue(nil, i.GuildID).ID
+		assigned = 0
+		failed   = 0
+		reason   = fmt.Sprintf("New level role added (Level %d)", level)
+	)
+
+	for _, userId := range userIds {
+		err := m.discord.AddGuildMemberRole(ctx, guildId, userId, role, reason)
+		if err == nil {
+			assigned++
+			continue
+		}
+
+		logger.Error(ctx, "Error whilst adding the role", zap.String("guildId", guildId), zap.String("roleId", role), zap.String("userToAdd", userId), zap.Error(err))
+
+		var restErr *rest.Error
+		if ctx.Err() != nil || (errors.As(err, &restErr) && restErr.StatusCode == http.StatusForbidden) {
+			return assigned, failed, err
+		}
+		failed++
+	}
+
+	return assigned, failed, nil
+}
+
+func (m LevelRolesCommand) subcmd_remove(ctx context.Context, r discord.Responder, i discordgo.Interaction, options levelRolesRemoveOptions) {
+	var (
+		role          = options.Role
 		alreadyExists = false
 	)
 
-	if err := m.db.GetContext(c.Request().Context(), &alreadyExists, "SELECT exists(SELECT 1 FROM level_roles WHERE guildId = ? AND id = ?)", i.GuildID, role); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether levelrole exists", zap.Error(err))
-		utils.SendResponse(c, "Error getting level roles", true, true)
+	if err := m.db.GetContext(ctx, &alreadyExists, "SELECT exists(SELECT 1 FROM level_roles WHERE guildId = ? AND id = ?)", i.GuildID, role); err != nil {
+		logger.Error(ctx, "Error whilst checking whether levelrole exists", zap.Error(err))
+		r.Error("Error getting level roles")
 		return
 	}
 
 	if !alreadyExists {
-		utils.SendResponse(c, "Level role does not exist", true, true)
+		r.Error("Level role does not exist")
 		return
 	}
 
 	if _, err := m.db.Exec("DELETE FROM level_roles WHERE id = ?", role); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst deleting the levelrole", zap.Error(err))
-		utils.SendResponse(c, "Error removing level role", true, true)
+		logger.Error(ctx, "Error whilst deleting the levelrole", zap.Error(err))
+		r.Error("Error removing level role")
 		return
 	}
+	m.invalidate(ctx, i.GuildID)
 
 	responseMsg := fmt.Sprintf("<@&%s> has been removed as a level role", role)
 
-	utils.SendResponse(c, responseMsg, false, false)
+	r.Reply(responseMsg)
 }
 
-func (m LevelRolesCommand) subcmd_list(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
-	var (
-		levelRoles []model.LevelRole
-	)
-
-	if err := m.db.SelectContext(c.Request().Context(), &levelRoles, "SELECT * FROM level_roles WHERE guildId = ?", i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst getting list of level roles", zap.Error(err))
-		utils.SendResponse(c, "Error getting level roles", true, true)
+func (m LevelRolesCommand) subcmd_list(ctx context.Context, r discord.Responder, i discordgo.Interaction, options struct{}) {
+	levelRoles, err := m.store.LevelRoles(ctx, i.GuildID)
+	if err != nil {
+		logger.Error(ctx, "Error whilst getting list of level roles", zap.Error(err))
+		r.Error("Error getting level roles")
 		return
 	}
 
@@ -187,9 +249,30 @@ func (m LevelRolesCommand) subcmd_list(c echo.Context, i discordgo.Interaction,
 		levelRolesStrings[i] = fmt.Sprintf("- <@&%s> at level **%d**", levelRoles[i].Id, levelRoles[i].Level)
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("**Level Roles**\n\n%s", strings.Join(levelRolesStrings, "\n")), false, false)
+	r.Reply(fmt.Sprintf("**Level Roles**\n\n%s", strings.Join(levelRolesStrings, "\n")))
+}
+
+// invalidate drops the cached level roles after a change. The change itself
+// has been made, so a failure is only logged.
+func (m LevelRolesCommand) invalidate(ctx context.Context, guildId string) {
+	if err := m.store.Invalidate(ctx, guildId); err != nil {
+		logger.Error(ctx, "Error whilst invalidating cached level roles", zap.String("guildId", guildId), zap.Error(err))
+	}
 }
 
-func NewLevelRolesCommand(db *sqlx.DB) LevelRolesCommand {
-	return LevelRolesCommand{db: db}
+func (m LevelRolesCommand) Mutates(i discordgo.Interaction) bool {
+	path := discord.SubCommandPath(i)
+	return len(path) > 0 && path[len(path)-1] != "list"
+}
+
+// NewLevelRolesCommand assigns new level roles through client, which must
+// authenticate as the main bot, in jobs started on runner.
+func NewLevelRolesCommand(db *sqlx.DB, store *store.Store, client rest.Client, runner *background.Runner) LevelRolesCommand {
+	m := LevelRolesCommand{db: db, store: store, discord: client, jobs: runner, router: discord.NewRouter()}
+
+	discord.Handle(m.router, "add", m.subcmd_add)
+	discord.Handle(m.router, "remove", m.subcmd_remove)
+	discord.Handle(m.router, "list", m.subcmd_list)
+
+	return m
 }
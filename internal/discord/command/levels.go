@@ -1,11 +1,11 @@
 package command
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/model"
 	"github.com/prosperitybot/common/utils"
@@ -15,7 +15,13 @@ import (
 
 type LevelsCommand struct {
 	discord.SlashCommand
-	db *sqlx.DB
+	db     *sqlx.DB
+	router discord.Router
+}
+
+type levelsOptions struct {
+	User   string `option:"user"`
+	Levels int64  `option:"levels"`
 }
 
 func (m LevelsCommand) Command() discordgo.ApplicationCommand {
@@ -75,27 +81,28 @@ func (m LevelsCommand) Command() discordgo.ApplicationCommand {
 	}
 }
 
-func (m LevelsCommand) Execute(c echo.Context, i discordgo.Interaction) {
-	subCommand := i.ApplicationCommandData().Options[0]
+func (m LevelsCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	m.router.Execute(ctx, r, i)
+}
 
-	switch subCommand.Name {
-	case "give":
-		m.subcmd(c, i, subCommand, true)
-	case "take":
-		m.subcmd(c, i, subCommand, false)
-	}
+func (m LevelsCommand) subcmd_give(ctx context.Context, r discord.Responder, i discordgo.Interaction, options levelsOptions) {
+	m.subcmd(ctx, r, i, options, true)
+}
+
+func (m LevelsCommand) subcmd_take(ctx context.Context, r discord.Responder, i discordgo.Interaction, options levelsOptions) {
+	m.subcmd(ctx, r, i, options, false)
 }
 
-func (m LevelsCommand) subcmd(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption, shouldGive bool) {
+func (m LevelsCommand) subcmd(ctx context.Context, r discord.Responder, i discordgo.Interaction, options levelsOptions, shouldGive bool) {
 	var (
-		userId    = subCommand.Options[0].UserValue(nil).ID
-		levels    = subCommand.Options[1].IntValue()
+		userId    = options.User
+		levels    = options.Levels
 		guildUser model.GuildUser
 	)
 
 	if err := m.db.Get(&guildUser, "SELECT * FROM guild_users WHERE guildId = ? AND userId = ?", i.GuildID, userId); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst getting user level", zap.Error(err))
-		utils.SendResponse(c, "Error getting user", true, true)
+		logger.Error(ctx, "Error whilst getting user level", zap.Error(err))
+		r.Error("Error getting user")
 		return
 	}
 
@@ -105,16 +112,16 @@ func (m LevelsCommand) subcmd(c echo.Context, i discordgo.Interaction, subComman
 		guildUser.Level -= int(levels)
 
 		if guildUser.Level < 0 {
-			logger.Warn(c.Request().Context(), "User level is less than 0", zap.Int("level", guildUser.Level))
-			utils.SendResponse(c, "User level cannot be less than 0", true, true)
+			logger.Warn(ctx, "User level is less than 0", zap.Int("level", guildUser.Level))
+			r.Error("User level cannot be less than 0")
 			return
 		}
 	}
 	guildUser.Xp = utils.GetXPRequired(guildUser.Level-1) + 1
 
-	if _, err := m.db.NamedExecContext(c.Request().Context(), "UPDATE guild_users SET level = :level, xp = :xp WHERE guildId = :guildId AND userId = :userId", guildUser); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst updating user level", zap.Error(err))
-		utils.SendResponse(c, "Error updating user", true, true)
+	if _, err := m.db.NamedExecContext(ctx, "UPDATE guild_users SET level = :level, xp = :xp WHERE guildId = :guildId AND userId = :userId", guildUser); err != nil {
+		logger.Error(ctx, "Error whilst updating user level", zap.Error(err))
+		r.Error("Error updating user")
 		return
 	}
 
@@ -126,9 +133,18 @@ func (m LevelsCommand) subcmd(c echo.Context, i discordgo.Interaction, subComman
 		middle = "from"
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("%s **%d** level(s) %s <@%s>", prefix, levels, middle, userId), false, false)
+	r.Reply(fmt.Sprintf("%s **%d** level(s) %s <@%s>", prefix, levels, middle, userId))
+}
+
+func (m LevelsCommand) Mutates(i discordgo.Interaction) bool {
+	return true
 }
 
 func NewLevelsCommand(db *sqlx.DB) LevelsCommand {
-	return LevelsCommand{db: db}
+	m := LevelsCommand{db: db, router: discord.NewRouter()}
+
+	discord.Handle(m.router, "give", m.subcmd_give)
+	discord.Handle(m.router, "take", m.subcmd_take)
+
+	return m
 }
@@ -1,15 +1,19 @@
 package command
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/utils"
+	"github.com/prosperitybot/worker/internal/cooldown"
 	"github.com/prosperitybot/worker/internal/discord"
 	"github.com/prosperitybot/worker/internal/discord/component"
+	"github.com/prosperitybot/worker/internal/store"
 	"go.uber.org/zap"
 )
 
@@ -17,6 +21,31 @@ type SettingsCommand struct {
 	discord.SlashCommand
 	settingNotificationComponent component.SettingsNotificationComponent
 	db                           *sqlx.DB
+	store                        *store.Store
+	cooldowns                    *cooldown.Limiter
+	defaultCooldowns             map[string]discord.Cooldown
+	router                       discord.Router
+}
+
+type settingsNotificationsOptions struct {
+	Channel *string `option:"channel"`
+}
+
+type settingsRolesOptions struct {
+	Type string `option:"type"`
+}
+
+type settingsMultiplierOptions struct {
+	Multiplier float64 `option:"multiplier"`
+}
+
+type settingsDelayOptions struct {
+	Delay int64 `option:"delay"`
+}
+
+type settingsCooldownOptions struct {
+	Command string `option:"command"`
+	Seconds *int   `option:"seconds"`
 }
 
 func (m SettingsCommand) Command() discordgo.ApplicationCommand {
@@ -25,7 +54,14 @@ func (m SettingsCommand) Command() discordgo.ApplicationCommand {
 		dmAccess           bool    = false
 		minMultiplierValue float64 = 0.0
 		minDelay           float64 = 1
+		minCooldown        float64 = 0
+		commandChoices             = make([]*discordgo.ApplicationCommandOptionChoice, 0, len(m.defaultCooldowns))
 	)
+
+	for _, name := range m.cooldownCommands() {
+		commandChoices = append(commandChoices, &discordgo.ApplicationCommandOptionChoice{Name: "/" + name, Value: name})
+	}
+
 	return discordgo.ApplicationCommand{
 		Name:                     "settings",
 		Type:                     discordgo.ChatApplicationCommand,
@@ -99,39 +135,58 @@ func (m SettingsCommand) Command() discordgo.ApplicationCommand {
 					},
 				},
 			},
+			{
+				Name:        "cooldown",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Description: "Choose how long members have to wait between uses of a command",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "command",
+						Type:        discordgo.ApplicationCommandOptionString,
+						Description: "The command to change the cooldown of",
+						Required:    true,
+						Choices:     commandChoices,
+					},
+					{
+						Name:        "seconds",
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Description: "The cooldown in seconds, 0 turns it off (leave out to go back to the default)",
+						Required:    false,
+						MinValue:    &minCooldown,
+						MaxValue:    cooldown.MaxDuration.Seconds(),
+					},
+				},
+			},
 		},
 	}
 }
 
-func (m SettingsCommand) Execute(c echo.Context, i discordgo.Interaction) {
-	subCommand := i.ApplicationCommandData().Options[0]
-
-	switch subCommand.Name {
-	case "notifications":
-		m.subcmd_notifications(c, i, subCommand)
-	case "roles":
-		m.subcmd_roles(c, i, subCommand)
-	case "multiplier":
-		m.subcmd_multiplier(c, i, subCommand)
-	case "delay":
-		m.subcmd_delay(c, i, subCommand)
-	}
+func (m SettingsCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	m.router.Execute(ctx, r, i)
 }
 
-func (m SettingsCommand) subcmd_notifications(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
-	if len(subCommand.Options) > 0 {
+func (m SettingsCommand) subcmd_notifications(ctx context.Context, r discord.Responder, i discordgo.Interaction, options settingsNotificationsOptions) {
+	if options.Channel != nil {
 		// Has supplied a channel
-		channelId := subCommand.Options[0].ChannelValue(nil).ID
+		channelId := *options.Channel
 
 		if _, err := m.db.Exec("UPDATE guilds SET notificationType = ?, notificationChannel = ? WHERE id = ?", "channel", channelId, i.GuildID); err != nil {
-			logger.Error(c.Request().Context(), "failed to update guild settings", zap.Error(err))
-			utils.SendResponse(c, "Failed to update guild settings", true, true)
+			logger.Error(ctx, "failed to update guild settings", zap.Error(err))
+			r.Error("Failed to update guild settings")
 			return
 		}
 
-		utils.SendResponse(c, fmt.Sprintf("Set the notifications channel to <#%s>", channelId), true, false)
+		m.invalidate(ctx, i.GuildID)
+
+		r.Ephemeral(fmt.Sprintf("Set the notifications channel to <#%s>", channelId))
 	} else {
-		// Has not supplied a channel, go with other
+		// Has not supplied a channel, go with other. The menu still works
+		// without the current setting selected
+		guild, _, err := m.store.Guild(ctx, i.GuildID)
+		if err != nil {
+			logger.Error(ctx, "failed to get guild settings", zap.Error(err))
+		}
+
 		var (
 			embed = utils.CreateEmbed(&discordgo.MessageEmbed{
 				Description: "Please select the type of notifications you below",
@@ -139,13 +194,13 @@ func (m SettingsCommand) subcmd_notifications(c echo.Context, i discordgo.Intera
 			components = []discordgo.MessageComponent{
 				discordgo.ActionsRow{
 					Components: []discordgo.MessageComponent{
-						m.settingNotificationComponent.BaseComponent(),
+						m.settingNotificationComponent.Menu(guild.NotificationType),
 					},
 				},
 			}
 		)
 
-		utils.SendComplexResponse(c, discordgo.InteractionResponseData{
+		r.Respond(discordgo.InteractionResponseData{
 			Flags:      discordgo.MessageFlagsEphemeral,
 			Embeds:     []*discordgo.MessageEmbed{embed},
 			Components: components,
@@ -153,48 +208,124 @@ func (m SettingsCommand) subcmd_notifications(c echo.Context, i discordgo.Intera
 	}
 }
 
-func (m SettingsCommand) subcmd_roles(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m SettingsCommand) subcmd_roles(ctx context.Context, r discord.Responder, i discordgo.Interaction, options settingsRolesOptions) {
 	var (
-		roleAssignmentType = subCommand.Options[0].StringValue()
+		roleAssignmentType = options.Type
 	)
 
 	if _, err := m.db.Exec("UPDATE guilds SET roleAssignType = ? WHERE id = ?", roleAssignmentType, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "failed to update guild settings", zap.Error(err))
-		utils.SendResponse(c, "Failed to update guild settings", true, true)
+		logger.Error(ctx, "failed to update guild settings", zap.Error(err))
+		r.Error("Failed to update guild settings")
 		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("Set the role assignment type to `%s`", roleAssignmentType), true, false)
+	m.invalidate(ctx, i.GuildID)
+
+	r.Ephemeral(fmt.Sprintf("Set the role assignment type to `%s`", roleAssignmentType))
 }
 
-func (m SettingsCommand) subcmd_multiplier(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m SettingsCommand) subcmd_multiplier(ctx context.Context, r discord.Responder, i discordgo.Interaction, options settingsMultiplierOptions) {
 	var (
-		multiplier = subCommand.Options[0].FloatValue()
+		multiplier = options.Multiplier
 	)
 
 	if _, err := m.db.Exec("UPDATE guilds SET xpRate = ? WHERE id = ?", multiplier, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "failed to update guild settings", zap.Error(err))
-		utils.SendResponse(c, "Failed to update guild settings", true, true)
+		logger.Error(ctx, "failed to update guild settings", zap.Error(err))
+		r.Error("Failed to update guild settings")
 		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("Set the XP multiplier to `%f`", multiplier), true, false)
+	m.invalidate(ctx, i.GuildID)
+
+	r.Ephemeral(fmt.Sprintf("Set the XP multiplier to `%f`", multiplier))
 }
 
-func (m SettingsCommand) subcmd_delay(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m SettingsCommand) subcmd_delay(ctx context.Context, r discord.Responder, i discordgo.Interaction, options settingsDelayOptions) {
 	var (
-		delay = subCommand.Options[0].IntValue()
+		delay = options.Delay
 	)
 
 	if _, err := m.db.Exec("UPDATE guilds SET xpDelay = ? WHERE id = ?", delay, i.GuildID); err != nil {
-		logger.Error(c.Request().Context(), "failed to update guild settings", zap.Error(err))
-		utils.SendResponse(c, "Failed to update guild settings", true, true)
+		logger.Error(ctx, "failed to update guild settings", zap.Error(err))
+		r.Error("Failed to update guild settings")
 		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("Set the XP delay to `%d`", delay), true, false)
+	m.invalidate(ctx, i.GuildID)
+
+	r.Ephemeral(fmt.Sprintf("Set the XP delay to `%d`", delay))
 }
 
-func NewSettingsCommand(db *sqlx.DB, settingsComponent component.SettingsNotificationComponent) SettingsCommand {
-	return SettingsCommand{db: db}
+func (m SettingsCommand) subcmd_cooldown(ctx context.Context, r discord.Responder, i discordgo.Interaction, options settingsCooldownOptions) {
+	defaultCooldown, ok := m.defaultCooldowns[options.Command]
+	if !ok {
+		r.Error(fmt.Sprintf("/%s does not have a cooldown", options.Command))
+		return
+	}
+
+	if options.Seconds == nil {
+		if err := m.cooldowns.ResetOverride(ctx, i.GuildID, options.Command); err != nil {
+			logger.Error(ctx, "failed to reset command cooldown", zap.String("command", options.Command), zap.Error(err))
+			r.Error("Failed to update guild settings")
+			return
+		}
+
+		r.Ephemeral(fmt.Sprintf("Set the cooldown of `/%s` back to the default of `%d` seconds", options.Command, int(defaultCooldown.Duration.Seconds())))
+		return
+	}
+
+	if err := m.cooldowns.SetOverride(ctx, i.GuildID, options.Command, time.Duration(*options.Seconds)*time.Second); err != nil {
+		logger.Error(ctx, "failed to update command cooldown", zap.String("command", options.Command), zap.Error(err))
+		r.Error("Failed to update guild settings")
+		return
+	}
+
+	if *options.Seconds == 0 {
+		r.Ephemeral(fmt.Sprintf("Turned off the cooldown of `/%s`", options.Command))
+		return
+	}
+
+	r.Ephemeral(fmt.Sprintf("Set the cooldown of `/%s` to `%d` seconds", options.Command, *options.Seconds))
+}
+
+// invalidate drops the cached guild settings after a change. The change itself
+// has been made, so a failure is only logged.
+func (m SettingsCommand) invalidate(ctx context.Context, guildId string) {
+	if err := m.store.Invalidate(ctx, guildId); err != nil {
+		logger.Error(ctx, "failed to invalidate cached guild settings", zap.String("guildId", guildId), zap.Error(err))
+	}
+}
+
+func (m SettingsCommand) cooldownCommands() []string {
+	names := make([]string, 0, len(m.defaultCooldowns))
+	for name := range m.defaultCooldowns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m SettingsCommand) Mutates(i discordgo.Interaction) bool {
+	return true
+}
+
+// NewSettingsCommand lets guilds override the cooldowns in defaultCooldowns,
+// see discord.Cooldowns.
+func NewSettingsCommand(db *sqlx.DB, store *store.Store, settingsComponent component.SettingsNotificationComponent, cooldowns *cooldown.Limiter, defaultCooldowns map[string]discord.Cooldown) SettingsCommand {
+	m := SettingsCommand{
+		db:                           db,
+		store:                        store,
+		settingNotificationComponent: settingsComponent,
+		cooldowns:                    cooldowns,
+		defaultCooldowns:             defaultCooldowns,
+		router:                       discord.NewRouter(),
+	}
+
+	discord.Handle(m.router, "notifications", m.subcmd_notifications)
+	discord.Handle(m.router, "roles", m.subcmd_roles)
+	discord.Handle(m.router, "multiplier", m.subcmd_multiplier)
+	discord.Handle(m.router, "delay", m.subcmd_delay)
+	discord.Handle(m.router, "cooldown", m.subcmd_cooldown)
+
+	return m
 }
@@ -1,23 +1,37 @@
 package command
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/model"
 	"github.com/prosperitybot/common/utils"
+	"github.com/prosperitybot/worker/internal/background"
+	"github.com/prosperitybot/worker/internal/cache"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest"
 	"go.uber.org/zap"
 )
 
 type WhitelabelCommand struct {
 	discord.SlashCommand
-	db *sqlx.DB
+	db         *sqlx.DB
+	publicKeys *cache.PublicKeyCache
+	registrar  *register.Registrar
+	discord    rest.Client
+	jobs       *background.Runner
+	baseUrl    string
+	router     discord.Router
+}
+
+type whitelabelSetupOptions struct {
+	Token     string `option:"token"`
+	PublicKey string `option:"public_key"`
 }
 
 func (m WhitelabelCommand) Command() discordgo.ApplicationCommand {
@@ -56,92 +70,138 @@ func (m WhitelabelCommand) Command() discordgo.ApplicationCommand {
 	}
 }
 
-func (m WhitelabelCommand) Execute(c echo.Context, i discordgo.Interaction) {
+func (m WhitelabelCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
 	var (
-		subCommand   = i.ApplicationCommandData().Options[0]
 		isWhitelabel = false
 	)
 
-	if err := m.db.GetContext(c.Request().Context(), &isWhitelabel, "SELECT exists (SELECT 1 FROM users WHERE id = ? AND premium_status = true)", i.Member.User.ID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether user is whitelabel", zap.Error(err))
-		utils.SendResponse(c, "Could not check for whitelabel permissions", true, true)
+	if err := m.db.GetContext(ctx, &isWhitelabel, "SELECT exists (SELECT 1 FROM users WHERE id = ? AND premium_status = true)", discord.InvokingUserId(i)); err != nil {
+		logger.Error(ctx, "Error whilst checking whether user is whitelabel", zap.Error(err))
+		r.Error("Could not check for whitelabel permissions")
 		return
 	}
 
 	if !isWhitelabel {
-		utils.SendResponse(c, "You are not a whitelabel client", true, true)
+		r.Error("You are not a whitelabel client")
 		return
 	}
 
-	switch subCommand.Name {
-	case "setup":
-		m.subcmd_setup(c, i, subCommand)
-	case "actions":
-		m.subcmd_actions(c, i, subCommand)
+	m.router.Execute(ctx, r, i)
+}
+
+// subcmd_setup looks the bot up and registers its commands with Discord,
+// which can take longer than Discord waits for a response, so it is done in a
+// background job after deferring.
+func (m WhitelabelCommand) subcmd_setup(ctx context.Context, r discord.Responder, i discordgo.Interaction, options whitelabelSetupOptions) {
+	if err := r.Defer(true); err != nil {
+		logger.Error(ctx, "Error whilst deferring the response", zap.Error(err))
+		return
 	}
+
+	userId := discord.InvokingUserId(i)
+
+	m.jobs.Go("whitelabel-setup", func(jobCtx context.Context) {
+		responseMsg, err := m.setup(jobCtx, userId, options)
+
+		editCtx, cancel := context.WithTimeout(context.Background(), discord.EditTimeout)
+		defer cancel()
+
+		if err := r.EditOriginal(editCtx, discord.MessageEdit(responseMsg, err != nil)); err != nil {
+			logger.Error(jobCtx, "Error whilst editing the whitelabel setup response", zap.String("userId", userId), zap.Error(err))
+		}
+	})
 }
 
-func (m WhitelabelCommand) subcmd_setup(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+// setup stores the user's bot and registers its commands, returning the
+// message to show them. The error is only set when the message is an error.
+func (m WhitelabelCommand) setup(ctx context.Context, userId string, options whitelabelSetupOptions) (string, error) {
 	var (
-		botToken          = subCommand.Options[0].StringValue()
-		publicKey         = subCommand.Options[1].StringValue()
+		botToken          = options.Token
+		publicKey         = options.PublicKey
 		userAlreadyHasBot = false
 		action            = "start"
 		bot               = model.WhitelabelBot{
-			UserId:    &i.Member.User.ID,
+			UserId:    &userId,
 			Token:     botToken,
 			PublicKey: &publicKey,
 			Action:    &action,
 		}
 	)
 
-	if err := bot.FillInfoByToken(); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst collecting bot user information", zap.Error(err))
-		utils.SendResponse(c, "Invalid bot token", true, true)
-		return
+	if err := m.fillBotInfo(ctx, &bot); err != nil {
+		logger.Error(ctx, "Error whilst collecting bot user information", zap.Error(err))
+		return "Invalid bot token", err
 	}
 
-	if err := m.db.GetContext(c.Request().Context(), &userAlreadyHasBot, "SELECT exists (SELECT 1 FROM whitelabel_bots WHERE userId = ?)", i.Member.User.ID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst checking whether user already has a bot", zap.Error(err))
-		utils.SendResponse(c, "Could not activate whitelabel bot", true, true)
-		return
+	if err := m.db.GetContext(ctx, &userAlreadyHasBot, "SELECT exists (SELECT 1 FROM whitelabel_bots WHERE userId = ?)", userId); err != nil {
+		logger.Error(ctx, "Error whilst checking whether user already has a bot", zap.Error(err))
+		return "Could not activate whitelabel bot", err
 	}
 
 	if userAlreadyHasBot {
 		// Get old bot information
 		var oldBot model.WhitelabelBot
-		if err := m.db.GetContext(c.Request().Context(), &oldBot, "SELECT * FROM whitelabel_bots WHERE userId = ?", i.Member.User.ID); err != nil {
-			logger.Error(c.Request().Context(), "Error whilst getting old bot information", zap.Error(err))
-			utils.SendResponse(c, "Could not activate whitelabel bot", true, true)
-			return
+		if err := m.db.GetContext(ctx, &oldBot, "SELECT * FROM whitelabel_bots WHERE userId = ?", userId); err != nil {
+			logger.Error(ctx, "Error whilst getting old bot information", zap.Error(err))
+			return "Could not activate whitelabel bot", err
 		}
 		bot = oldBot
-		bot.UserId = &i.Member.User.ID
+		bot.UserId = &userId
 		bot.OldId = &oldBot.Id
 		bot.Token = botToken
 		bot.PublicKey = &publicKey
 		action := "recreate"
 		bot.Action = &action
-		if err := bot.FillInfoByToken(); err != nil {
-			logger.Error(c.Request().Context(), "Error whilst logging bot user information", zap.Error(err))
-			utils.SendResponse(c, "Invalid bot token", true, true)
+		if err := m.fillBotInfo(ctx, &bot); err != nil {
+			logger.Error(ctx, "Error whilst logging bot user information", zap.Error(err))
+			return "Invalid bot token", err
 		}
 	}
 
 	// Insert bot into database
-	if _, err := m.db.NamedExecContext(c.Request().Context(), "INSERT INTO whitelabel_bots (userId, botId, oldBotId, token, publicKey, action, botName, botDiscrim, botAvatarHash, createdAt, updatedAt) VALUES (:userId, :botId, :oldBotId, :token, :publicKey, :action, :botName, :botDiscrim, :botAvatarHash, :createdAt, :updatedAt) ON DUPLICATE KEY UPDATE botId = :botId, oldBotId = :oldBotId, token = :token, publicKey = :publicKey, botName = :botName, botDiscrim = :botDiscrim, updatedAt = :updatedAt", bot); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst inserting bot into database", zap.Error(err))
-		utils.SendResponse(c, "Could not activate whitelabel bot", true, true)
-		return
+	if _, err := m.db.NamedExecContext(ctx, "INSERT INTO whitelabel_bots (userId, botId, oldBotId, token, publicKey, action, botName, botDiscrim, botAvatarHash, createdAt, updatedAt) VALUES (:userId, :botId, :oldBotId, :token, :publicKey, :action, :botName, :botDiscrim, :botAvatarHash, :createdAt, :updatedAt) ON DUPLICATE KEY UPDATE botId = :botId, oldBotId = :oldBotId, token = :token, publicKey = :publicKey, botName = :botName, botDiscrim = :botDiscrim, updatedAt = :updatedAt", bot); err != nil {
+		logger.Error(ctx, "Error whilst inserting bot into database", zap.Error(err))
+		return "Could not activate whitelabel bot", err
 	}
 
-	interactionsEndpointUrl := "https://" + os.Getenv("WORKER_BASE_URL") + "/interactions/" + bot.Id
+	botIds := []string{bot.Id}
+	if bot.OldId != nil {
+		botIds = append(botIds, *bot.OldId)
+	}
+	// The bot has been saved, other workers accept its interactions once
+	// their copy of the key expires if this fails
+	if err := m.publicKeys.Invalidate(ctx, botIds...); err != nil {
+		logger.Error(ctx, "Error whilst invalidating cached public keys", zap.Strings("botIds", botIds), zap.Error(err))
+	}
+
+	interactionsEndpointUrl := "https://" + m.baseUrl + "/interactions/" + bot.Id
 	developerPage := fmt.Sprintf("https://discord.com/developers/applications/%s/information", bot.Id)
+	responseMsg := fmt.Sprintf("Whitelabel bot activated\n\nPlease put the following link in `INTERACTIONS ENDPOINT URL` [here](%s): \n`%s`", developerPage, interactionsEndpointUrl)
+
+	if err := m.registrar.Register(ctx, bot.Id, bot.Token); err != nil {
+		logger.Error(ctx, "Error whilst registering commands for whitelabel bot", zap.String("botId", bot.Id), zap.Error(err))
+		responseMsg += "\n\nCommands could not be registered yet, they will be retried automatically"
+	}
+
+	return responseMsg, nil
+}
 
-	utils.SendResponse(c, fmt.Sprintf("Whitelabel bot activated\n\nPlease put the following link in `INTERACTIONS ENDPOINT URL` [here](%s): \n`%s`", developerPage, interactionsEndpointUrl), true, false)
+// fillBotInfo looks up the bot user for the bot's token.
+func (m WhitelabelCommand) fillBotInfo(ctx context.Context, bot *model.WhitelabelBot) error {
+	botUser, err := m.discord.WithToken(bot.Token).CurrentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	bot.Id = botUser.ID
+	bot.Name = &botUser.Username
+	bot.Discriminator = &botUser.Discriminator
+	bot.AvatarHash = &botUser.Avatar
+
+	return nil
 }
 
-func (m WhitelabelCommand) subcmd_actions(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption) {
+func (m WhitelabelCommand) subcmd_actions(ctx context.Context, r discord.Responder, i discordgo.Interaction, options struct{}) {
 
 	var (
 		embed = utils.CreateEmbed(&discordgo.MessageEmbed{
@@ -152,14 +212,14 @@ func (m WhitelabelCommand) subcmd_actions(c echo.Context, i discordgo.Interactio
 		botComponents = []discordgo.SelectMenuOption{}
 	)
 
-	if err := m.db.SelectContext(c.Request().Context(), &bots, "SELECT * FROM whitelabel_bots WHERE userId = ?", i.Member.User.ID); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst getting bots assigned to user", zap.Error(err))
-		utils.SendResponse(c, "Could not get whitelabel bot actions", true, true)
+	if err := m.db.SelectContext(ctx, &bots, "SELECT * FROM whitelabel_bots WHERE userId = ?", discord.InvokingUserId(i)); err != nil {
+		logger.Error(ctx, "Error whilst getting bots assigned to user", zap.Error(err))
+		r.Error("Could not get whitelabel bot actions")
 		return
 	}
 
 	if len(bots) == 0 {
-		utils.SendResponse(c, "You don't have any whitelabel bots", true, true)
+		r.Error("You don't have any whitelabel bots")
 		return
 	}
 
@@ -171,7 +231,7 @@ func (m WhitelabelCommand) subcmd_actions(c echo.Context, i discordgo.Interactio
 		})
 	}
 
-	utils.SendComplexResponse(c, discordgo.InteractionResponseData{
+	r.Respond(discordgo.InteractionResponseData{
 		Flags:  discordgo.MessageFlagsEphemeral,
 		Embeds: []*discordgo.MessageEmbed{embed},
 		Components: []discordgo.MessageComponent{
@@ -188,6 +248,17 @@ func (m WhitelabelCommand) subcmd_actions(c echo.Context, i discordgo.Interactio
 	})
 }
 
-func NewWhitelabelCommand(db *sqlx.DB) WhitelabelCommand {
-	return WhitelabelCommand{db: db}
+func (m WhitelabelCommand) Mutates(i discordgo.Interaction) bool {
+	path := discord.SubCommandPath(i)
+	return len(path) > 0 && path[0] == "setup"
+}
+
+// NewWhitelabelCommand sets bots up in jobs started on runner.
+func NewWhitelabelCommand(db *sqlx.DB, publicKeys *cache.PublicKeyCache, registrar *register.Registrar, client rest.Client, runner *background.Runner, baseUrl string) WhitelabelCommand {
+	m := WhitelabelCommand{db: db, publicKeys: publicKeys, registrar: registrar, discord: client, jobs: runner, baseUrl: baseUrl, router: discord.NewRouter()}
+
+	discord.Handle(m.router, "setup", m.subcmd_setup)
+	discord.Handle(m.router, "actions", m.subcmd_actions)
+
+	return m
 }
@@ -1,11 +1,11 @@
 package command
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/model"
 	"github.com/prosperitybot/common/utils"
@@ -15,7 +15,20 @@ import (
 
 type XpCommand struct {
 	discord.SlashCommand
-	db *sqlx.DB
+	db     *sqlx.DB
+	router discord.Router
+}
+
+type xpOptions struct {
+	User string `option:"user"`
+	Xp   int64  `option:"xp"`
+}
+
+// xpTakeOptions is xpOptions for take, where the amount has always been called
+// levels.
+type xpTakeOptions struct {
+	User string `option:"user"`
+	Xp   int64  `option:"levels"`
 }
 
 func (m XpCommand) Command() discordgo.ApplicationCommand {
@@ -75,28 +88,29 @@ func (m XpCommand) Command() discordgo.ApplicationCommand {
 	}
 }
 
-func (m XpCommand) Execute(c echo.Context, i discordgo.Interaction) {
-	subCommand := i.ApplicationCommandData().Options[0]
+func (m XpCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	m.router.Execute(ctx, r, i)
+}
 
-	switch subCommand.Name {
-	case "give":
-		m.subcmd(c, i, subCommand, true)
-	case "take":
-		m.subcmd(c, i, subCommand, false)
-	}
+func (m XpCommand) subcmd_give(ctx context.Context, r discord.Responder, i discordgo.Interaction, options xpOptions) {
+	m.subcmd(ctx, r, i, options, true)
 }
 
-func (m XpCommand) subcmd(c echo.Context, i discordgo.Interaction, subCommand *discordgo.ApplicationCommandInteractionDataOption, shouldGive bool) {
+func (m XpCommand) subcmd_take(ctx context.Context, r discord.Responder, i discordgo.Interaction, options xpTakeOptions) {
+	m.subcmd(ctx, r, i, xpOptions(options), false)
+}
+
+func (m XpCommand) subcmd(ctx context.Context, r discord.Responder, i discordgo.Interaction, options xpOptions, shouldGive bool) {
 	var (
-		userId     = subCommand.Options[0].UserValue(nil).ID
-		xp         = subCommand.Options[1].IntValue()
+		userId     = options.User
+		xp         = options.Xp
 		guildUser  model.GuildUser
 		levelFound = false
 	)
 
 	if err := m.db.Get(&guildUser, "SELECT * FROM guild_users WHERE guildId = ? AND userId = ?", i.GuildID, userId); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst getting user xp", zap.Error(err))
-		utils.SendResponse(c, "Error getting user", true, true)
+		logger.Error(ctx, "Error whilst getting user xp", zap.Error(err))
+		r.Error("Error getting user")
 		return
 	}
 
@@ -127,14 +141,23 @@ func (m XpCommand) subcmd(c echo.Context, i discordgo.Interaction, subCommand *d
 		}
 	}
 
-	if _, err := m.db.NamedExecContext(c.Request().Context(), "UPDATE guild_users SET level = :level, xp = :xp WHERE guildId = :guildId AND userId = :userId", guildUser); err != nil {
-		logger.Error(c.Request().Context(), "Error whilst updating user xp", zap.Error(err))
-		utils.SendResponse(c, "Error updating user", true, true)
+	if _, err := m.db.NamedExecContext(ctx, "UPDATE guild_users SET level = :level, xp = :xp WHERE guildId = :guildId AND userId = :userId", guildUser); err != nil {
+		logger.Error(ctx, "Error whilst updating user xp", zap.Error(err))
+		r.Error("Error updating user")
 		return
 	}
-	utils.SendResponse(c, fmt.Sprintf("%s **%d** xp %s <@%s>", prefix, xp, middle, userId), false, false)
+	r.Reply(fmt.Sprintf("%s **%d** xp %s <@%s>", prefix, xp, middle, userId))
+}
+
+func (m XpCommand) Mutates(i discordgo.Interaction) bool {
+	return true
 }
 
 func NewXpCommand(db *sqlx.DB) XpCommand {
-	return XpCommand{db: db}
+	m := XpCommand{db: db, router: discord.NewRouter()}
+
+	discord.Handle(m.router, "give", m.subcmd_give)
+	discord.Handle(m.router, "take", m.subcmd_take)
+
+	return m
 }
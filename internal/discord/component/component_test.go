@@ -0,0 +1,317 @@
+package component_test
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/component"
+	"github.com/prosperitybot/worker/internal/discord/customid"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest/resttest"
+	it "github.com/prosperitybot/worker/internal/interactiontest"
+	"github.com/prosperitybot/worker/internal/rank"
+)
+
+const (
+	otherUserId = "500000000000000005"
+	botId       = "700000000000000007"
+)
+
+func setup(env it.Env) (map[string]discord.SlashCommand, map[string]discord.Component) {
+	registrar := register.NewRegistrar(env.DB, env.Discord, "")
+
+	return map[string]discord.SlashCommand{}, map[string]discord.Component{
+		component.LeaderboardPageId:   component.NewLeaderboardPageComponent(rank.NewService(env.DB, rank.DefaultTotalTTL), env.CustomIds),
+		"settings::notifications":     component.NewSettingsNotificationComponent(env.DB, env.Store),
+		"whitelabel::botselection":    component.NewWhitelabelBotSelectionComponent(env.DB, env.CustomIds),
+		component.WhitelabelActionsId: component.NewWhitelabelActionsComponent(env.DB, registrar, env.Jobs),
+	}
+}
+
+func query(sql string) string {
+	return regexp.QuoteMeta(sql)
+}
+
+// actions builds the signed whitelabel actions menu ID shown to userId.
+func actions(h *it.Harness, userId string) string {
+	h.T.Helper()
+
+	id, err := h.CustomIds.Encode(component.WhitelabelActionsId, botId, userId)
+	if err != nil {
+		h.T.Fatalf("encoding custom id: %s", err)
+	}
+	return id
+}
+
+// page builds the signed ID of a leaderboard button.
+func page(h *it.Harness, values ...string) string {
+	h.T.Helper()
+
+	id, err := h.CustomIds.Encode(component.LeaderboardPageId, values...)
+	if err != nil {
+		h.T.Fatalf("encoding custom id: %s", err)
+	}
+	return id
+}
+
+func members(userIds ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"userId", "level", "xp", "username"})
+	for n, userId := range userIds {
+		rows.AddRow(userId, 10-n, 1000-n*10, "member-"+userId)
+	}
+	return rows
+}
+
+func TestLeaderboardPage(t *testing.T) {
+	const (
+		after      = "WHERE gu.guildId = ? AND (gu.xp < ? OR (gu.xp = ? AND gu.userId > ?))"
+		before     = "WHERE gu.guildId = ? AND (gu.xp > ? OR (gu.xp = ? AND gu.userId < ?))"
+		firstPage  = "FROM (SELECT userId FROM guild_users WHERE guildId = ? ORDER BY xp DESC, userId LIMIT ? OFFSET ?)"
+		countQuery = "SELECT COUNT(*) FROM guild_users WHERE guildId = ?"
+	)
+
+	var tenMembers []string
+	for n := 0; n < 10; n++ {
+		tenMembers = append(tenMembers, fmt.Sprintf("5000000000000000%02d", n))
+	}
+
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "next",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component(page(h, "next", "2", "400", otherUserId))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query(after)).
+					WithArgs(it.GuildId, 400, 400, otherUserId, 10).
+					WillReturnRows(members(it.UserId))
+				mock.ExpectQuery(query(countQuery)).
+					WithArgs(it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+			},
+			Want: "Top 10 Members (Page 2 of 2)\n\n 11. member-" + it.UserId + " - Level 10",
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				if response.Type != discordgo.InteractionResponseUpdateMessage {
+					t.Errorf("expected the leaderboard to be updated, got type %d", response.Type)
+				}
+
+				row := response.Data.Components[0].(*discordgo.ActionsRow)
+				previous := row.Components[0].(*discordgo.Button)
+				next := row.Components[1].(*discordgo.Button)
+				if previous.Disabled || !next.Disabled {
+					t.Errorf("expected only previous to be enabled on the last page, got %+v and %+v", previous, next)
+				}
+			},
+		},
+		{
+			Name: "previous",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component(page(h, "previous", "2", "100", it.UserId))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query(before)).
+					WithArgs(it.GuildId, 100, 100, it.UserId, 10).
+					WillReturnRows(members(tenMembers...))
+				mock.ExpectQuery(query(countQuery)).
+					WithArgs(it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(30))
+			},
+			// Read closest first, so the last row read is at the top
+			Want: "Top 10 Members (Page 2 of 3)\n\n 11. member-" + tenMembers[9],
+		},
+		{
+			Name: "previous after members moved up",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component(page(h, "previous", "3", "100", it.UserId))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query(before)).
+					WithArgs(it.GuildId, 100, 100, it.UserId, 10).
+					WillReturnRows(members(otherUserId))
+				mock.ExpectQuery(query(firstPage)).
+					WithArgs(it.GuildId, 10, 0, it.GuildId).
+					WillReturnRows(members(otherUserId))
+				mock.ExpectQuery(query(countQuery)).
+					WithArgs(it.GuildId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			},
+			Want: "Top 10 Members (Page 1 of 1)\n\n 1. member-" + otherUserId,
+		},
+		{
+			Name: "next past the end",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component(page(h, "next", "2", "400", otherUserId))
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query(after)).
+					WithArgs(it.GuildId, 400, 400, otherUserId, 10).
+					WillReturnRows(members())
+			},
+			Want:      "There is nobody further down the leaderboard",
+			Ephemeral: true,
+		},
+		{
+			Name:        "unsigned",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Component(component.LeaderboardPageId) },
+			Want:        "This is no longer valid, please run the command again",
+			Ephemeral:   true,
+		},
+	})
+}
+
+func TestSettingsNotification(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name: "direct messages",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component("settings::notifications", "settings::notifications::dm")
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("UPDATE guilds SET notificationType = ?, notificationChannel = NULL WHERE id = ?")).
+					WithArgs("dm", it.GuildId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "sent via **Direct Messages**",
+			Ephemeral: true,
+		},
+		{
+			Name: "channel",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component("settings::notifications", "settings::notifications::channel")
+			},
+			Want:      "Please use the slash command `/settings notifications` and specify the channel",
+			Ephemeral: true,
+		},
+	})
+}
+
+func TestWhitelabelBotSelection(t *testing.T) {
+	const ownsBot = "SELECT exists (SELECT 1 FROM whitelabel_bots WHERE botId = ? AND userId = ?)"
+
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name:        "own bot",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Component("whitelabel::botselection", botId) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query(ownsBot)).
+					WithArgs(botId, it.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			},
+			Want:      "Select an action for the bot with id `" + botId + "`",
+			Ephemeral: true,
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				row := response.Data.Components[0].(*discordgo.ActionsRow)
+				menu := row.Components[0].(*discordgo.SelectMenu)
+
+				prefix, values, err := h.CustomIds.Decode(menu.CustomID)
+				if err != nil {
+					t.Fatalf("decoding actions menu id %q: %s", menu.CustomID, err)
+				}
+				if prefix != component.WhitelabelActionsId || len(values) != 2 || values[0] != botId || values[1] != it.UserId {
+					t.Errorf("unexpected actions menu state %s %v", prefix, values)
+				}
+			},
+		},
+		{
+			Name:        "someone else's bot",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Component("whitelabel::botselection", botId) },
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query(ownsBot)).
+					WithArgs(botId, it.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			Want:      "You can only manage your own whitelabel bots",
+			Ephemeral: true,
+		},
+	})
+}
+
+func TestWhitelabelActions(t *testing.T) {
+	it.RunCases(t, setup, []it.Case{
+		{
+			Name:        "signed for the invoker",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Component(actions(h, it.UserId), "stop") },
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query("UPDATE whitelabel_bots SET action = ? WHERE botId = ?")).
+					WithArgs("stop", botId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			Want:      "Whitelabel bot has been set to `stop`",
+			Ephemeral: true,
+		},
+		{
+			Name: "resync",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component(actions(h, it.UserId), component.WhitelabelActionResync)
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("SELECT token FROM whitelabel_bots WHERE botId = ?")).
+					WithArgs(botId).
+					WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("whitelabel-token"))
+			},
+			Discord: func(server *resttest.Server) {
+				server.Respond(http.MethodGet, "applications/"+botId+"/commands", http.StatusOK, []discordgo.ApplicationCommand{})
+			},
+			Ephemeral: true,
+			Check: func(t *testing.T, h *it.Harness, response discordgo.InteractionResponse) {
+				if response.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+					t.Errorf("expected a deferred response, got type %d", response.Type)
+				}
+
+				edits := h.Edits()
+				if len(edits) != 1 || it.EditDescription(edits[0]) != "Commands have been re-synced" {
+					t.Errorf("expected the response to be edited once re-synced, got %d edits", len(edits))
+				}
+
+				calls := h.Discord.CallsTo(http.MethodGet, "applications/"+botId+"/commands")
+				if len(calls) != 1 || calls[0].Header.Get("Authorization") != "Bot whitelabel-token" {
+					t.Errorf("expected the commands to be read with the bot's token, got %+v", calls)
+				}
+			},
+		},
+		{
+			Name:        "nothing selected",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Component(actions(h, it.UserId)) },
+			Want:        "Please select an action",
+			Ephemeral:   true,
+		},
+		{
+			Name: "from before custom ids were signed",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				return h.Component(component.WhitelabelActionsId+"_"+botId, "delete")
+			},
+			Want:      "This is no longer valid, please run the command again",
+			Ephemeral: true,
+		},
+		{
+			Name:        "signed for another user",
+			Interaction: func(h *it.Harness) discordgo.Interaction { return h.Component(actions(h, otherUserId), "delete") },
+			Want:        "You can only manage your own whitelabel bots",
+			Ephemeral:   true,
+		},
+		{
+			Name: "tampered",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				id := []byte(actions(h, it.UserId))
+				id[len(id)-1] ^= 1
+				return h.Component(string(id), "delete")
+			},
+			Want:      "This is no longer valid, please run the command again",
+			Ephemeral: true,
+		},
+		{
+			Name: "signed with another key",
+			Interaction: func(h *it.Harness) discordgo.Interaction {
+				id, _ := customid.NewCodec([]byte("another key")).Encode(component.WhitelabelActionsId, botId, it.UserId)
+				return h.Component(id, "delete")
+			},
+			Want:      "This is no longer valid, please run the command again",
+			Ephemeral: true,
+		},
+	})
+}
@@ -0,0 +1,162 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/common/logger"
+	"github.com/prosperitybot/common/utils"
+	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/customid"
+	"github.com/prosperitybot/worker/internal/rank"
+	"go.uber.org/zap"
+)
+
+const (
+	LeaderboardPageId   = "leaderboard::page"
+	LeaderboardPageSize = 10
+
+	leaderboardNext     = "next"
+	leaderboardPrevious = "previous"
+)
+
+// LeaderboardPageComponent is the previous and next buttons of the
+// leaderboard. Their custom IDs carry the member they page from, so moving
+// through the leaderboard costs the same however far down it is.
+type LeaderboardPageComponent struct {
+	discord.Component
+	ranks     *rank.Service
+	customIds customid.Codec
+}
+
+func (s LeaderboardPageComponent) BaseComponent() discordgo.MessageComponent {
+	return discordgo.Button{
+		CustomID: LeaderboardPageId,
+		Label:    "Next",
+		Style:    discordgo.SecondaryButton,
+	}
+}
+
+func (s LeaderboardPageComponent) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	// The custom ID carries the direction, the page being moved to and the
+	// member at the edge of the current page
+	var (
+		state, _  = customid.FromContext(ctx)
+		direction = state.Value(0)
+		userId    = state.Value(3)
+		guildId   = i.GuildID
+	)
+
+	page, err := strconv.Atoi(state.Value(1))
+	if err != nil || page < 1 {
+		r.Error("This is no longer valid, please run the command again")
+		return
+	}
+	xp, err := strconv.ParseInt(state.Value(2), 10, 64)
+	if err != nil {
+		r.Error("This is no longer valid, please run the command again")
+		return
+	}
+
+	var members []rank.Member
+
+	switch {
+	case direction == leaderboardNext:
+		members, err = s.ranks.After(ctx, guildId, xp, userId, LeaderboardPageSize)
+	case page == 1:
+		members, err = s.ranks.Page(ctx, guildId, page, LeaderboardPageSize)
+	default:
+		members, err = s.ranks.Before(ctx, guildId, xp, userId, LeaderboardPageSize)
+		// Members have moved up past the top of the page, start again from
+		// the top
+		if err == nil && len(members) < LeaderboardPageSize {
+			page = 1
+			members, err = s.ranks.Page(ctx, guildId, page, LeaderboardPageSize)
+		}
+	}
+	if err != nil {
+		logger.Error(ctx, "Error getting list of users for the leaderboard", zap.Error(err))
+		r.Error("Error getting leaderboard")
+		return
+	}
+
+	if len(members) == 0 {
+		r.Error("There is nobody further down the leaderboard")
+		return
+	}
+
+	total, err := s.ranks.Total(ctx, guildId)
+	if err != nil {
+		logger.Error(ctx, "Error getting amount of users in guild for leaderboard", zap.Error(err))
+		r.Error("Could not fetch leaderboard")
+		return
+	}
+
+	data, err := s.Message(page, total, members)
+	if err != nil {
+		logger.Error(ctx, "Error whilst building leaderboard buttons", zap.Error(err))
+		r.Error("Error getting leaderboard")
+		return
+	}
+
+	r.UpdateMessage(data)
+}
+
+// Message shows members as the given page of a leaderboard of total members,
+// with buttons to the pages either side.
+func (s LeaderboardPageComponent) Message(page int, total int, members []rank.Member) (discordgo.InteractionResponseData, error) {
+	lines := make([]string, len(members))
+	for n, member := range members {
+		lines[n] = fmt.Sprintf("%d. %s - Level %d", (page-1)*LeaderboardPageSize+n+1, member.Username, member.Level)
+	}
+
+	pages := (total + LeaderboardPageSize - 1) / LeaderboardPageSize
+	if pages < page {
+		pages = page
+	}
+
+	data := discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{utils.CreateEmbed(&discordgo.MessageEmbed{
+			Description: fmt.Sprintf("Top 10 Members (Page %d of %d)\n\n %s", page, pages, strings.Join(lines, "\n")),
+		}, false)},
+	}
+
+	if len(members) == 0 || pages == 1 {
+		return data, nil
+	}
+
+	var (
+		first = members[0]
+		last  = members[len(members)-1]
+	)
+
+	previous, err := s.customIds.Encode(LeaderboardPageId, leaderboardPrevious, strconv.Itoa(page-1), strconv.FormatInt(first.Xp, 10), first.UserId)
+	if err != nil {
+		return data, err
+	}
+	next, err := s.customIds.Encode(LeaderboardPageId, leaderboardNext, strconv.Itoa(page+1), strconv.FormatInt(last.Xp, 10), last.UserId)
+	if err != nil {
+		return data, err
+	}
+
+	data.Components = []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{CustomID: previous, Label: "Previous", Style: discordgo.SecondaryButton, Disabled: page == 1},
+				discordgo.Button{CustomID: next, Label: "Next", Style: discordgo.SecondaryButton, Disabled: page >= pages},
+			},
+		},
+	}
+
+	return data, nil
+}
+
+func NewLeaderboardPageComponent(ranks *rank.Service, customIds customid.Codec) LeaderboardPageComponent {
+	return LeaderboardPageComponent{
+		ranks:     ranks,
+		customIds: customIds,
+	}
+}
@@ -1,62 +1,74 @@
 package component
 
 import (
+	"context"
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
-	"github.com/prosperitybot/common/utils"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/store"
 	"go.uber.org/zap"
 )
 
 type SettingsNotificationComponent struct {
 	discord.Component
-	db *sqlx.DB
+	db    *sqlx.DB
+	store *store.Store
 }
 
 func (s SettingsNotificationComponent) BaseComponent() discordgo.MessageComponent {
-	return discordgo.SelectMenu{
-		CustomID: "settings::notifications",
-		MenuType: discordgo.StringSelectMenu,
-		Options: []discordgo.SelectMenuOption{
-			{
-				Label:       "Reply to Message",
-				Description: "Reply to the message that triggered the level up",
-				Value:       "settings::notifications::reply",
-				Emoji: discordgo.ComponentEmoji{
-					Name: "💬",
-				},
+	return s.Menu("")
+}
+
+// Menu is the select menu with current, a guild's notificationType, selected.
+func (s SettingsNotificationComponent) Menu(current string) discordgo.MessageComponent {
+	options := []discordgo.SelectMenuOption{
+		{
+			Label:       "Reply to Message",
+			Description: "Reply to the message that triggered the level up",
+			Value:       "settings::notifications::reply",
+			Emoji: discordgo.ComponentEmoji{
+				Name: "💬",
 			},
-			{
-				Label:       "Specify Channel",
-				Description: "Specify a channel to send the notifications to",
-				Value:       "settings::notifications::channel",
-				Emoji: discordgo.ComponentEmoji{
-					Name: "📃",
-				},
+		},
+		{
+			Label:       "Specify Channel",
+			Description: "Specify a channel to send the notifications to",
+			Value:       "settings::notifications::channel",
+			Emoji: discordgo.ComponentEmoji{
+				Name: "📃",
 			},
-			{
-				Label:       "Direct Messages",
-				Description: "Send the notifications to the user's DMs",
-				Value:       "settings::notifications::dm",
-				Emoji: discordgo.ComponentEmoji{
-					Name: "🔏",
-				},
+		},
+		{
+			Label:       "Direct Messages",
+			Description: "Send the notifications to the user's DMs",
+			Value:       "settings::notifications::dm",
+			Emoji: discordgo.ComponentEmoji{
+				Name: "🔏",
 			},
-			{
-				Label:       "Disable Notifications",
-				Description: "Disable notifications for the server",
-				Value:       "settings::notifications::disable",
-				Emoji: discordgo.ComponentEmoji{
-					Name: "🚫",
-				},
+		},
+		{
+			Label:       "Disable Notifications",
+			Description: "Disable notifications for the server",
+			Value:       "settings::notifications::disable",
+			Emoji: discordgo.ComponentEmoji{
+				Name: "🚫",
 			},
 		},
 	}
+
+	for n := range options {
+		options[n].Default = options[n].Value == "settings::notifications::"+current
+	}
+
+	return discordgo.SelectMenu{
+		CustomID: "settings::notifications",
+		MenuType: discordgo.StringSelectMenu,
+		Options:  options,
+	}
 }
 
-func (s SettingsNotificationComponent) Execute(c echo.Context, i discordgo.Interaction) {
+func (s SettingsNotificationComponent) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
 	var (
 		notificationTypeValue = i.MessageComponentData().Values[0]
 		notificationType      string
@@ -83,16 +95,25 @@ func (s SettingsNotificationComponent) Execute(c echo.Context, i discordgo.Inter
 
 	if notificationType != "NOT_UPDATED" {
 		if _, err := s.db.Exec("UPDATE guilds SET notificationType = ?, notificationChannel = NULL WHERE id = ?", notificationType, i.GuildID); err != nil {
-			logger.Error(c.Request().Context(), "failed to update guild notification type", zap.Error(err))
-			utils.SendResponse(c, "Failed to update guild notification type", true, true)
+			logger.Error(ctx, "failed to update guild notification type", zap.Error(err))
+			r.Error("Failed to update guild notification type")
+			return
+		}
+		if err := s.store.Invalidate(ctx, i.GuildID); err != nil {
+			logger.Error(ctx, "failed to invalidate cached guild settings", zap.Error(err))
 		}
 	}
 
-	utils.SendResponse(c, responseMsg, true, false)
+	r.Ephemeral(responseMsg)
+}
+
+func (s SettingsNotificationComponent) Mutates(i discordgo.Interaction) bool {
+	return true
 }
 
-func NewSettingsNotificationComponent(db *sqlx.DB) SettingsNotificationComponent {
+func NewSettingsNotificationComponent(db *sqlx.DB, store *store.Store) SettingsNotificationComponent {
 	return SettingsNotificationComponent{
-		db: db,
+		db:    db,
+		store: store,
 	}
 }
@@ -1,46 +1,113 @@
 package component
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
-	"github.com/prosperitybot/common/utils"
+	"github.com/prosperitybot/worker/internal/background"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/customid"
+	"github.com/prosperitybot/worker/internal/discord/register"
 	"go.uber.org/zap"
 )
 
+const (
+	WhitelabelActionsId    = "whitelabel::actions"
+	WhitelabelActionResync = "resync"
+)
+
 type WhitelabelActionsComponent struct {
 	discord.Component
-	db *sqlx.DB
+	db        *sqlx.DB
+	registrar *register.Registrar
+	jobs      *background.Runner
 }
 
 func (s WhitelabelActionsComponent) BaseComponent() discordgo.MessageComponent {
 	return discordgo.SelectMenu{
-		CustomID: "whitelabel::actions_FAKE_BOT_ID",
+		CustomID: WhitelabelActionsId,
 		MenuType: discordgo.StringSelectMenu,
 		Options:  []discordgo.SelectMenuOption{},
 	}
 }
 
-func (s WhitelabelActionsComponent) Execute(c echo.Context, i discordgo.Interaction) {
+func (s WhitelabelActionsComponent) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	// The custom ID is signed with the bot and the user it was shown to
+	state, ok := customid.FromContext(ctx)
+	if !ok || state.Value(1) != discord.InvokingUserId(i) {
+		r.Error("You can only manage your own whitelabel bots")
+		return
+	}
+
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		r.Error("Please select an action")
+		return
+	}
+
 	var (
-		botId  = strings.Split(i.MessageComponentData().CustomID, "_")[1]
-		action = i.MessageComponentData().Values[0]
+		botId  = state.Value(0)
+		action = values[0]
 	)
 
-	if err := s.db.Get(&botId, "UPDATE whitelabel_bots SET action = ? WHERE botId = ?", action, botId); err != nil {
-		logger.Error(c.Request().Context(), "failed to update whitelabel bot action", zap.Error(err))
+	if action == WhitelabelActionResync {
+		s.resync(ctx, r, botId)
+		return
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE whitelabel_bots SET action = ? WHERE botId = ?", action, botId); err != nil {
+		logger.Error(ctx, "failed to update whitelabel bot action", zap.Error(err))
+		r.Error("Failed to update whitelabel bot action")
+		return
 	}
 
-	utils.SendResponse(c, fmt.Sprintf("Whitelabel bot has been set to `%s`", action), true, false)
+	r.Ephemeral(fmt.Sprintf("Whitelabel bot has been set to `%s`", action))
+}
+
+// resync registers the bot's commands in a background job after deferring, as
+// it can take longer than Discord waits for a response.
+func (s WhitelabelActionsComponent) resync(ctx context.Context, r discord.Responder, botId string) {
+	var token string
+
+	if err := s.db.GetContext(ctx, &token, "SELECT token FROM whitelabel_bots WHERE botId = ?", botId); err != nil {
+		logger.Error(ctx, "failed to get whitelabel bot token", zap.Error(err))
+		r.Error("Failed to re-sync commands")
+		return
+	}
+
+	if err := r.Defer(true); err != nil {
+		logger.Error(ctx, "failed to defer the response", zap.Error(err))
+		return
+	}
+
+	s.jobs.Go("whitelabel-resync", func(jobCtx context.Context) {
+		edit := discord.MessageEdit("Commands have been re-synced", false)
+		if err := s.registrar.Register(jobCtx, botId, token); err != nil {
+			logger.Error(jobCtx, "failed to register whitelabel bot commands", zap.String("botId", botId), zap.Error(err))
+			edit = discord.MessageEdit("Failed to re-sync commands", true)
+		}
+
+		editCtx, cancel := context.WithTimeout(context.Background(), discord.EditTimeout)
+		defer cancel()
+
+		if err := r.EditOriginal(editCtx, edit); err != nil {
+			logger.Error(jobCtx, "failed to edit the re-sync response", zap.String("botId", botId), zap.Error(err))
+		}
+	})
+}
+
+func (s WhitelabelActionsComponent) Mutates(i discordgo.Interaction) bool {
+	return true
 }
 
-func NewWhitelabelActionsComponent(db *sqlx.DB) WhitelabelActionsComponent {
+// NewWhitelabelActionsComponent re-syncs commands in jobs started on runner.
+func NewWhitelabelActionsComponent(db *sqlx.DB, registrar *register.Registrar, runner *background.Runner) WhitelabelActionsComponent {
 	return WhitelabelActionsComponent{
-		db: db,
+		db:        db,
+		registrar: registrar,
+		jobs:      runner,
 	}
 }
@@ -1,18 +1,22 @@
 package component
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
-	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/utils"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/customid"
+	"go.uber.org/zap"
 )
 
 type WhitelabelBotSelectionComponent struct {
 	discord.Component
-	db *sqlx.DB
+	db        *sqlx.DB
+	customIds customid.Codec
 }
 
 func (s WhitelabelBotSelectionComponent) BaseComponent() discordgo.MessageComponent {
@@ -23,13 +27,32 @@ func (s WhitelabelBotSelectionComponent) BaseComponent() discordgo.MessageCompon
 	}
 }
 
-func (s WhitelabelBotSelectionComponent) Execute(c echo.Context, i discordgo.Interaction) {
+func (s WhitelabelBotSelectionComponent) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
 	var (
-		botId    = i.MessageComponentData().Values[0]
-		menuName = fmt.Sprintf("whitelabel::actions_%s", botId)
+		botId   = i.MessageComponentData().Values[0]
+		userId  = discord.InvokingUserId(i)
+		ownsBot = false
 	)
 
-	utils.SendComplexResponse(c, discordgo.InteractionResponseData{
+	if err := s.db.GetContext(ctx, &ownsBot, "SELECT exists (SELECT 1 FROM whitelabel_bots WHERE botId = ? AND userId = ?)", botId, userId); err != nil {
+		logger.Error(ctx, "Error whilst checking whitelabel bot ownership", zap.Error(err))
+		r.Error("Could not get whitelabel bot actions")
+		return
+	}
+
+	if !ownsBot {
+		r.Error("You can only manage your own whitelabel bots")
+		return
+	}
+
+	menuName, err := s.customIds.Encode(WhitelabelActionsId, botId, userId)
+	if err != nil {
+		logger.Error(ctx, "Error whilst building whitelabel actions menu", zap.Error(err))
+		r.Error("Could not get whitelabel bot actions")
+		return
+	}
+
+	r.Respond(discordgo.InteractionResponseData{
 		Flags: discordgo.MessageFlagsEphemeral,
 		Embeds: []*discordgo.MessageEmbed{utils.CreateEmbed(&discordgo.MessageEmbed{
 			Description: fmt.Sprintf("Select an action for the bot with id `%s`", botId),
@@ -57,6 +80,10 @@ func (s WhitelabelBotSelectionComponent) Execute(c echo.Context, i discordgo.Int
 								Label: "Delete",
 								Value: "delete",
 							},
+							{
+								Label: "Re-sync Commands",
+								Value: "resync",
+							},
 						},
 					},
 				},
@@ -65,8 +92,9 @@ func (s WhitelabelBotSelectionComponent) Execute(c echo.Context, i discordgo.Int
 	})
 }
 
-func NewWhitelabelBotSelectionComponent(db *sqlx.DB) WhitelabelBotSelectionComponent {
+func NewWhitelabelBotSelectionComponent(db *sqlx.DB, customIds customid.Codec) WhitelabelBotSelectionComponent {
 	return WhitelabelBotSelectionComponent{
-		db: db,
+		db:        db,
+		customIds: customIds,
 	}
 }
@@ -0,0 +1,30 @@
+package customid
+
+import "context"
+
+type contextKey struct{}
+
+// State is the verified content of a component's custom ID.
+type State struct {
+	Prefix string
+	Values []string
+}
+
+// Value returns the n-th value, or "" if there are fewer values.
+func (s State) Value(n int) string {
+	if n < 0 || n >= len(s.Values) {
+		return ""
+	}
+	return s.Values[n]
+}
+
+func WithState(ctx context.Context, state State) context.Context {
+	return context.WithValue(ctx, contextKey{}, state)
+}
+
+// FromContext returns the state decoded from the custom ID of the component
+// interaction being handled.
+func FromContext(ctx context.Context) (State, bool) {
+	state, ok := ctx.Value(contextKey{}).(State)
+	return state, ok
+}
@@ -0,0 +1,171 @@
+package customid
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A custom ID carrying state looks like
+//
+//	<prefix>|<version><payload>.<mac>
+//
+// where the payload is a compact binary encoding of the values and the mac is
+// a truncated HMAC-SHA256 over everything before it. Discord limits custom IDs
+// to 100 characters, so values are kept small: numeric values such as
+// snowflakes are stored as varints.
+const (
+	MaxLength = 100
+
+	separator = "|"
+	version   = '1'
+	macSize   = 10
+
+	fieldNumber byte = 1
+	fieldString byte = 2
+)
+
+var (
+	ErrInvalid   = errors.New("invalid custom id")
+	ErrSignature = errors.New("custom id signature does not match")
+	ErrTooLong   = errors.New("custom id is longer than 100 characters")
+)
+
+var encoding = base64.RawURLEncoding
+
+type Codec struct {
+	key []byte
+}
+
+// Encode builds a custom ID for the component handling prefix, carrying
+// values.
+func (c Codec) Encode(prefix string, values ...string) (string, error) {
+	if prefix == "" || strings.Contains(prefix, separator) {
+		return "", fmt.Errorf("%w: prefix %q", ErrInvalid, prefix)
+	}
+
+	var payload []byte
+	for _, value := range values {
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil && strconv.FormatUint(n, 10) == value {
+			payload = append(payload, fieldNumber)
+			payload = binary.AppendUvarint(payload, n)
+			continue
+		}
+
+		payload = append(payload, fieldString)
+		payload = binary.AppendUvarint(payload, uint64(len(value)))
+		payload = append(payload, value...)
+	}
+
+	signed := prefix + separator + string(version) + encoding.EncodeToString(payload)
+	customId := signed + "." + encoding.EncodeToString(c.mac(signed))
+
+	if len(customId) > MaxLength {
+		return "", ErrTooLong
+	}
+
+	return customId, nil
+}
+
+// Decode verifies a custom ID built by Encode and returns its prefix and
+// values.
+func (c Codec) Decode(customId string) (string, []string, error) {
+	prefix, rest, ok := strings.Cut(customId, separator)
+	if !ok || rest == "" {
+		return "", nil, ErrInvalid
+	}
+
+	if rest[0] != version {
+		return "", nil, fmt.Errorf("%w: unknown version %q", ErrInvalid, rest[0])
+	}
+
+	dot := strings.LastIndexByte(customId, '.')
+	if dot < len(prefix) {
+		return "", nil, ErrInvalid
+	}
+
+	mac, err := encoding.DecodeString(customId[dot+1:])
+	if err != nil {
+		return "", nil, ErrInvalid
+	}
+	if !hmac.Equal(mac, c.mac(customId[:dot])) {
+		return "", nil, ErrSignature
+	}
+
+	payload, err := encoding.DecodeString(customId[len(prefix)+len(separator)+1 : dot])
+	if err != nil {
+		return "", nil, ErrInvalid
+	}
+
+	values, err := decodePayload(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return prefix, values, nil
+}
+
+func (c Codec) mac(signed string) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write([]byte(signed))
+	return h.Sum(nil)[:macSize]
+}
+
+func decodePayload(payload []byte) ([]string, error) {
+	values := []string{}
+
+	for len(payload) > 0 {
+		kind := payload[0]
+		payload = payload[1:]
+
+		n, read := binary.Uvarint(payload)
+		if read <= 0 {
+			return nil, ErrInvalid
+		}
+		payload = payload[read:]
+
+		switch kind {
+		case fieldNumber:
+			values = append(values, strconv.FormatUint(n, 10))
+		case fieldString:
+			if uint64(len(payload)) < n {
+				return nil, ErrInvalid
+			}
+			values = append(values, string(payload[:n]))
+			payload = payload[n:]
+		default:
+			return nil, ErrInvalid
+		}
+	}
+
+	return values, nil
+}
+
+// Prefix returns the prefix of a custom ID without verifying it, for finding
+// the component that handles it.
+func Prefix(customId string) string {
+	prefix, _, _ := strings.Cut(customId, separator)
+	return prefix
+}
+
+// IsEncoded reports whether customId looks like it was built by Encode.
+func IsEncoded(customId string) bool {
+	return strings.Contains(customId, separator)
+}
+
+func NewCodec(key []byte) Codec {
+	return Codec{key: key}
+}
+
+// DeriveKey derives a signing key from the bot token, for when no key has been
+// configured. Every replica shares the token, so they agree on the key.
+func DeriveKey(botToken string) []byte {
+	h := hmac.New(sha256.New, []byte(botToken))
+	h.Write([]byte("prosperity worker custom id"))
+	return h.Sum(nil)
+}
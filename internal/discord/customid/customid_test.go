@@ -0,0 +1,103 @@
+package customid_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prosperitybot/worker/internal/discord/customid"
+)
+
+var key = []byte("test key")
+
+// sign signs a custom ID the way the codec does, for building ones it
+// wouldn't.
+func sign(signed string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:10])
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"700000000000000007", "400000000000000004"},
+		{"next", "2", "150", "400000000000000004"},
+		{"", "007", "18446744073709551615", "with | and ."},
+	}
+
+	codec := customid.NewCodec(key)
+	for _, values := range tests {
+		encoded, err := codec.Encode("leaderboard::page", values...)
+		if err != nil {
+			t.Fatalf("encoding %q: %s", values, err)
+		}
+		if len(encoded) > customid.MaxLength {
+			t.Errorf("expected at most %d characters, got %d", customid.MaxLength, len(encoded))
+		}
+
+		prefix, decoded, err := codec.Decode(encoded)
+		if err != nil {
+			t.Fatalf("decoding %q: %s", encoded, err)
+		}
+		if prefix != "leaderboard::page" || !reflect.DeepEqual(decoded, values) {
+			t.Errorf("expected %q, got %q %q", values, prefix, decoded)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	codec := customid.NewCodec(key)
+
+	if _, err := codec.Encode("settings|notifications", "1"); !errors.Is(err, customid.ErrInvalid) {
+		t.Errorf("expected a prefix containing the separator to be invalid, got %v", err)
+	}
+	if _, err := codec.Encode("", "1"); !errors.Is(err, customid.ErrInvalid) {
+		t.Errorf("expected an empty prefix to be invalid, got %v", err)
+	}
+	if _, err := codec.Encode("whitelabel::actions", strings.Repeat("a", 70)); !errors.Is(err, customid.ErrTooLong) {
+		t.Errorf("expected a custom id over the length limit to be refused, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	codec := customid.NewCodec(key)
+	valid, err := codec.Encode("whitelabel::actions", "700000000000000007", "400000000000000004")
+	if err != nil {
+		t.Fatalf("encoding: %s", err)
+	}
+	unsigned := valid[:strings.LastIndexByte(valid, '.')]
+
+	tests := []struct {
+		name     string
+		customId string
+		want     error
+	}{
+		{"no separator", "whitelabel::actions", customid.ErrInvalid},
+		{"nothing after the separator", "whitelabel::actions|", customid.ErrInvalid},
+		{"wrong version", strings.Replace(valid, "|1", "|2", 1), customid.ErrInvalid},
+		{"missing mac", unsigned, customid.ErrInvalid},
+		{"mac isn't base64", unsigned + ".!!!", customid.ErrInvalid},
+		{"truncated mac", valid[:len(valid)-2], customid.ErrSignature},
+		{"signed with another key", func() string {
+			id, _ := customid.NewCodec([]byte("another key")).Encode("whitelabel::actions", "700000000000000007")
+			return id
+		}(), customid.ErrSignature},
+		{"prefix changed", "x" + valid, customid.ErrSignature},
+		{"payload isn't base64", sign("whitelabel::actions|1!!!"), customid.ErrInvalid},
+		{"payload truncated", sign("whitelabel::actions|1" + base64.RawURLEncoding.EncodeToString([]byte{2, 10, 'a'})), customid.ErrInvalid},
+		{"unknown field", sign("whitelabel::actions|1" + base64.RawURLEncoding.EncodeToString([]byte{9, 1})), customid.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := codec.Decode(tt.customId); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package discord
+
+import "github.com/bwmarrin/discordgo"
+
+// InvokingUser returns the user that triggered the interaction. Member is only
+// set for interactions inside a guild, DMs and user-installed contexts only
+// carry User.
+func InvokingUser(i discordgo.Interaction) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// InvokingUserId is the ID of InvokingUser, or "" if Discord sent neither.
+func InvokingUserId(i discordgo.Interaction) string {
+	if user := InvokingUser(i); user != nil {
+		return user.ID
+	}
+	return ""
+}
+
+// GuildOnly reports whether a command has opted out of being used in DMs.
+func GuildOnly(command discordgo.ApplicationCommand) bool {
+	return command.DMPermission != nil && !*command.DMPermission
+}
+
+// SubCommandPath returns the names of the subcommand group and subcommand
+// used, e.g. ["channels", "add"] for /ignored channels add.
+func SubCommandPath(i discordgo.Interaction) []string {
+	path, _ := subCommand(i)
+	return path
+}
+
+// subCommand walks down to the subcommand used, returning its path and the
+// options given to it.
+func subCommand(i discordgo.Interaction) ([]string, []*discordgo.ApplicationCommandInteractionDataOption) {
+	var (
+		path    []string
+		options = i.ApplicationCommandData().Options
+	)
+
+	for len(options) > 0 {
+		option := options[0]
+		if option.Type != discordgo.ApplicationCommandOptionSubCommand && option.Type != discordgo.ApplicationCommandOptionSubCommandGroup {
+			break
+		}
+		path = append(path, option.Name)
+		options = option.Options
+	}
+
+	return path, options
+}
@@ -0,0 +1,268 @@
+package register
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/common/logger"
+	"github.com/prosperitybot/common/model"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultReconcileInterval = 30 * time.Minute
+	DefaultRetryInterval     = 30 * time.Second
+)
+
+// Registrar keeps the commands registered on Discord for the main bot and
+// every whitelabel bot in sync with the worker's command set, only touching
+// the commands that have changed.
+type Registrar struct {
+	db         *sqlx.DB
+	client     rest.Client
+	commands   []discordgo.ApplicationCommand
+	devGuildId string
+
+	mu     sync.RWMutex
+	synced map[string]time.Time
+}
+
+// SetCommands must be called before the registrar is used. It is separate from
+// NewRegistrar because some commands need the registrar to be constructed.
+func (r *Registrar) SetCommands(commands []discordgo.ApplicationCommand) {
+	r.commands = append([]discordgo.ApplicationCommand{}, commands...)
+	sort.Slice(r.commands, func(i, j int) bool {
+		return r.commands[i].Name < r.commands[j].Name
+	})
+}
+
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+type Change struct {
+	Action  Action
+	Name    string
+	Id      string
+	Command discordgo.ApplicationCommand
+	Details []string
+}
+
+type Plan struct {
+	BotId     string
+	GuildId   string
+	Changes   []Change
+	Unchanged int
+}
+
+func (p Plan) String() string {
+	var sb strings.Builder
+
+	target := "global"
+	if p.GuildId != "" {
+		target = "guild " + p.GuildId
+	}
+	fmt.Fprintf(&sb, "bot %s (%s): %d changed, %d unchanged\n", p.BotId, target, len(p.Changes), p.Unchanged)
+
+	for _, change := range p.Changes {
+		fmt.Fprintf(&sb, "  %s /%s\n", change.Action, change.Name)
+		for _, detail := range change.Details {
+			fmt.Fprintf(&sb, "      %s\n", detail)
+		}
+	}
+
+	return sb.String()
+}
+
+// Plan compares the hash of every local command with what is registered for
+// the bot and works out which commands need creating, updating or deleting.
+func (r *Registrar) Plan(ctx context.Context, client rest.Client, botId string) (Plan, error) {
+	plan := Plan{BotId: botId, GuildId: r.devGuildId}
+
+	registered, err := client.ListCommands(ctx, botId, r.devGuildId)
+	if err != nil {
+		return plan, err
+	}
+
+	registeredByName := make(map[string]discordgo.ApplicationCommand, len(registered))
+	for _, command := range registered {
+		registeredByName[command.Name] = command
+	}
+
+	for _, command := range r.commands {
+		existing, ok := registeredByName[command.Name]
+		delete(registeredByName, command.Name)
+
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Name: command.Name, Command: command})
+			continue
+		}
+
+		registeredSchema, wantedSchema := newCommandSchema(existing), newCommandSchema(command)
+		if registeredSchema.hash() == wantedSchema.hash() {
+			plan.Unchanged++
+			continue
+		}
+
+		plan.Changes = append(plan.Changes, Change{
+			Action:  ActionUpdate,
+			Name:    command.Name,
+			Id:      existing.ID,
+			Command: command,
+			Details: diffSchemas(registeredSchema, wantedSchema),
+		})
+	}
+
+	for _, command := range registered {
+		if _, ok := registeredByName[command.Name]; ok {
+			plan.Changes = append(plan.Changes, Change{Action: ActionDelete, Name: command.Name, Id: command.ID})
+		}
+	}
+
+	return plan, nil
+}
+
+func (r *Registrar) Apply(ctx context.Context, client rest.Client, plan Plan) error {
+	for _, change := range plan.Changes {
+		var err error
+
+		switch change.Action {
+		case ActionCreate:
+			err = client.CreateCommand(ctx, plan.BotId, plan.GuildId, change.Command)
+		case ActionUpdate:
+			err = client.EditCommand(ctx, plan.BotId, plan.GuildId, change.Id, change.Command)
+		case ActionDelete:
+			err = client.DeleteCommand(ctx, plan.BotId, plan.GuildId, change.Id)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s /%s: %w", change.Action, change.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Registrar) Register(ctx context.Context, botId string, token string) error {
+	client := r.client.WithToken(token)
+
+	plan, err := r.Plan(ctx, client, botId)
+	if err != nil {
+		return err
+	}
+
+	logPlan(ctx, plan)
+
+	if err := r.Apply(ctx, client, plan); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.synced[botId] = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// LastSynced returns when the commands for the bot were last confirmed to be
+// in sync by this process.
+func (r *Registrar) LastSynced(botId string) (time.Time, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	synced, ok := r.synced[botId]
+	return synced, ok
+}
+
+func logPlan(ctx context.Context, plan Plan) {
+	for _, change := range plan.Changes {
+		logger.Info(ctx, fmt.Sprintf("Command %s /%s", change.Action, change.Name), zap.String("botId", plan.BotId), zap.Strings("changes", change.Details))
+	}
+
+	logger.Info(ctx, "Planned command registration", zap.String("botId", plan.BotId), zap.Int("changed", len(plan.Changes)), zap.Int("unchanged", plan.Unchanged))
+}
+
+func (r *Registrar) WhitelabelBots(ctx context.Context) ([]model.WhitelabelBot, error) {
+	var whitelabelBots []model.WhitelabelBot
+
+	if err := r.db.SelectContext(ctx, &whitelabelBots, "SELECT botId, token FROM whitelabel_bots"); err != nil {
+		return nil, err
+	}
+
+	return whitelabelBots, nil
+}
+
+func (r *Registrar) RegisterWhitelabelBots(ctx context.Context) error {
+	whitelabelBots, err := r.WhitelabelBots(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range whitelabelBots {
+		if err := r.Register(ctx, whitelabelBots[i].Id, whitelabelBots[i].Token); err != nil {
+			logger.Error(ctx, "Error registering commands for whitelabel bot", zap.String("botId", whitelabelBots[i].Id), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// RegisterWithRetry keeps trying to register the commands for a bot until it
+// succeeds or ctx is cancelled.
+func (r *Registrar) RegisterWithRetry(ctx context.Context, botId string, token string, interval time.Duration) {
+	for {
+		err := r.Register(ctx, botId, token)
+		if err == nil {
+			return
+		}
+
+		logger.Error(ctx, "Error registering commands, retrying", zap.String("botId", botId), zap.Duration("retryIn", interval), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Run registers the commands for every whitelabel bot straight away and then
+// again on every interval until ctx is cancelled.
+func (r *Registrar) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RegisterWhitelabelBots(ctx); err != nil {
+			logger.Error(ctx, "Error reconciling whitelabel bot commands", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewRegistrar creates a registrar that talks to Discord through client,
+// authenticating as each bot in turn.
+func NewRegistrar(db *sqlx.DB, client rest.Client, devGuildId string) *Registrar {
+	return &Registrar{
+		db:         db,
+		client:     client,
+		devGuildId: devGuildId,
+		synced:     map[string]time.Time{},
+	}
+}
@@ -0,0 +1,159 @@
+package register_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/discord/rest/resttest"
+)
+
+const botId = "700000000000000007"
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestHashDefaults(t *testing.T) {
+	base := discordgo.ApplicationCommand{
+		Name:        "level",
+		Type:        discordgo.ChatApplicationCommand,
+		Description: "Shows your level",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "who",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Description: "Who",
+				Choices:     []*discordgo.ApplicationCommandOptionChoice{{Name: "me", Value: 1}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *discordgo.ApplicationCommand)
+		same   bool
+	}{
+		{"dm permission defaults to true", func(c *discordgo.ApplicationCommand) { c.DMPermission = boolPtr(true) }, true},
+		{"dm permission turned off", func(c *discordgo.ApplicationCommand) { c.DMPermission = boolPtr(false) }, false},
+		{"nsfw defaults to false", func(c *discordgo.ApplicationCommand) { c.NSFW = boolPtr(false) }, true},
+		{"nsfw turned on", func(c *discordgo.ApplicationCommand) { c.NSFW = boolPtr(true) }, false},
+		{"type defaults to chat", func(c *discordgo.ApplicationCommand) { c.Type = 0 }, true},
+		{"user command", func(c *discordgo.ApplicationCommand) { c.Type = discordgo.UserApplicationCommand }, false},
+		{"fields set by Discord", func(c *discordgo.ApplicationCommand) { c.ID, c.ApplicationID, c.Version = "1", "2", "3" }, true},
+		{"integer choice read back as a float", func(c *discordgo.ApplicationCommand) {
+			c.Options = []*discordgo.ApplicationCommandOption{{
+				Name:        "who",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Description: "Who",
+				Choices:     []*discordgo.ApplicationCommandOptionChoice{{Name: "me", Value: float64(1)}},
+			}}
+		}, true},
+		{"description changed", func(c *discordgo.ApplicationCommand) { c.Description = "Shows a level" }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := base
+			tt.change(&changed)
+
+			if same := register.Hash(base) == register.Hash(changed); same != tt.same {
+				t.Errorf("expected the hashes to match to be %t", tt.same)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	var (
+		option = func(name string, required bool) *discordgo.ApplicationCommandOption {
+			return &discordgo.ApplicationCommandOption{Name: name, Type: discordgo.ApplicationCommandOptionString, Description: name, Required: required}
+		}
+		command = func(name string, description string, options ...*discordgo.ApplicationCommandOption) discordgo.ApplicationCommand {
+			return discordgo.ApplicationCommand{Name: name, Description: description, Options: options}
+		}
+	)
+
+	tests := []struct {
+		name       string
+		registered []discordgo.ApplicationCommand
+		wanted     []discordgo.ApplicationCommand
+		changes    []register.Change
+		unchanged  int
+	}{
+		{
+			name: "unchanged",
+			// Read back with the fields Discord fills in
+			registered: []discordgo.ApplicationCommand{{ID: "1", Version: "1", Name: "about", Type: discordgo.ChatApplicationCommand, Description: "About", DMPermission: boolPtr(true), NSFW: boolPtr(false)}},
+			wanted:     []discordgo.ApplicationCommand{command("about", "About")},
+			unchanged:  1,
+		},
+		{
+			name:    "created",
+			wanted:  []discordgo.ApplicationCommand{command("about", "About")},
+			changes: []register.Change{{Action: register.ActionCreate, Name: "about"}},
+		},
+		{
+			name:       "deleted",
+			registered: []discordgo.ApplicationCommand{{ID: "1", Name: "about", Description: "About"}},
+			changes:    []register.Change{{Action: register.ActionDelete, Name: "about", Id: "1"}},
+		},
+		{
+			name:       "description changed",
+			registered: []discordgo.ApplicationCommand{{ID: "1", Name: "about", Description: "About"}},
+			wanted:     []discordgo.ApplicationCommand{command("about", "About the bot")},
+			changes: []register.Change{{Action: register.ActionUpdate, Name: "about", Id: "1", Details: []string{
+				`description: "About" -> "About the bot"`,
+			}}},
+		},
+		{
+			name:       "options changed",
+			registered: []discordgo.ApplicationCommand{{ID: "1", Name: "xp", Description: "XP", Options: []*discordgo.ApplicationCommandOption{option("user", false), option("levels", true)}}},
+			wanted:     []discordgo.ApplicationCommand{command("xp", "XP", option("user", true), option("reason", false))},
+			changes: []register.Change{{Action: register.ActionUpdate, Name: "xp", Id: "1", Details: []string{
+				`~ xp user: {"type":3,"name":"user","description":"user","required":false,"autocomplete":false} -> {"type":3,"name":"user","description":"user","required":true,"autocomplete":false}`,
+				"+ xp reason",
+				"- xp levels",
+			}}},
+		},
+		{
+			name:       "options reordered",
+			registered: []discordgo.ApplicationCommand{{ID: "1", Name: "xp", Description: "XP", Options: []*discordgo.ApplicationCommandOption{option("user", false), option("amount", false)}}},
+			wanted:     []discordgo.ApplicationCommand{command("xp", "XP", option("amount", false), option("user", false))},
+			changes: []register.Change{{Action: register.ActionUpdate, Name: "xp", Id: "1", Details: []string{
+				"~ xp amount: moved to position 0",
+				"~ xp user: moved to position 1",
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := resttest.NewServer(t)
+			server.Respond(http.MethodGet, "applications/"+botId+"/commands", http.StatusOK, append([]discordgo.ApplicationCommand{}, tt.registered...))
+
+			registrar := register.NewRegistrar(nil, server.Client("token"), "")
+			registrar.SetCommands(tt.wanted)
+
+			plan, err := registrar.Plan(context.Background(), server.Client("token"), botId)
+			if err != nil {
+				t.Fatalf("planning: %s", err)
+			}
+
+			// The command sent is the one wanted, there's no need to compare it
+			for n := range plan.Changes {
+				plan.Changes[n].Command = discordgo.ApplicationCommand{}
+			}
+
+			if !reflect.DeepEqual(plan.Changes, tt.changes) {
+				t.Errorf("expected changes %+v, got %+v", tt.changes, plan.Changes)
+			}
+			if plan.Unchanged != tt.unchanged {
+				t.Errorf("expected %d unchanged, got %d", tt.unchanged, plan.Unchanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package register
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandSchema is the part of an application command that we control. Fields
+// Discord fills in (ids, versions) are left out and defaults are made explicit
+// so that a command we send and the same command read back hash the same.
+type commandSchema struct {
+	Name                     string                           `json:"name"`
+	Type                     discordgo.ApplicationCommandType `json:"type"`
+	Description              string                           `json:"description,omitempty"`
+	DefaultMemberPermissions *int64                           `json:"default_member_permissions,omitempty"`
+	DMPermission             bool                             `json:"dm_permission"`
+	NSFW                     bool                             `json:"nsfw"`
+	Options                  []optionSchema                   `json:"options,omitempty"`
+}
+
+type optionSchema struct {
+	Type         discordgo.ApplicationCommandOptionType `json:"type"`
+	Name         string                                 `json:"name"`
+	Description  string                                 `json:"description,omitempty"`
+	Required     bool                                   `json:"required"`
+	Autocomplete bool                                   `json:"autocomplete"`
+	ChannelTypes []discordgo.ChannelType                `json:"channel_types,omitempty"`
+	Choices      []choiceSchema                         `json:"choices,omitempty"`
+	MinValue     *float64                               `json:"min_value,omitempty"`
+	MaxValue     float64                                `json:"max_value,omitempty"`
+	MinLength    *int                                   `json:"min_length,omitempty"`
+	MaxLength    int                                    `json:"max_length,omitempty"`
+	Options      []optionSchema                         `json:"options,omitempty"`
+}
+
+type choiceSchema struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func newCommandSchema(command discordgo.ApplicationCommand) commandSchema {
+	schema := commandSchema{
+		Name:                     command.Name,
+		Type:                     command.Type,
+		Description:              command.Description,
+		DefaultMemberPermissions: command.DefaultMemberPermissions,
+		DMPermission:             command.DMPermission == nil || *command.DMPermission,
+		NSFW:                     command.NSFW != nil && *command.NSFW,
+		Options:                  newOptionSchemas(command.Options),
+	}
+
+	if schema.Type == 0 {
+		schema.Type = discordgo.ChatApplicationCommand
+	}
+
+	return schema
+}
+
+func newOptionSchemas(options []*discordgo.ApplicationCommandOption) []optionSchema {
+	if len(options) == 0 {
+		return nil
+	}
+
+	schemas := make([]optionSchema, len(options))
+	for i, option := range options {
+		schemas[i] = optionSchema{
+			Type:         option.Type,
+			Name:         option.Name,
+			Description:  option.Description,
+			Required:     option.Required,
+			Autocomplete: option.Autocomplete,
+			ChannelTypes: option.ChannelTypes,
+			MinValue:     option.MinValue,
+			MaxValue:     option.MaxValue,
+			MinLength:    option.MinLength,
+			MaxLength:    option.MaxLength,
+			Options:      newOptionSchemas(option.Options),
+		}
+
+		for _, choice := range option.Choices {
+			// Integer choices come back from Discord as float64, formatting
+			// them with %v gives the same string either way.
+			schemas[i].Choices = append(schemas[i].Choices, choiceSchema{
+				Name:  choice.Name,
+				Value: fmt.Sprintf("%v", choice.Value),
+			})
+		}
+	}
+
+	return schemas
+}
+
+// Hash returns a stable hash of the parts of a command definition that are
+// sent to Discord.
+func Hash(command discordgo.ApplicationCommand) string {
+	return newCommandSchema(command).hash()
+}
+
+func (s commandSchema) hash() string {
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func marshalString(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// diffSchemas lists the differences between what is registered and what we
+// want registered in a form that is readable in the logs.
+func diffSchemas(registered commandSchema, wanted commandSchema) []string {
+	var changes []string
+
+	if registered.Description != wanted.Description {
+		changes = append(changes, fmt.Sprintf("description: %q -> %q", registered.Description, wanted.Description))
+	}
+	if registered.Type != wanted.Type {
+		changes = append(changes, fmt.Sprintf("type: %d -> %d", registered.Type, wanted.Type))
+	}
+	if marshalString(registered.DefaultMemberPermissions) != marshalString(wanted.DefaultMemberPermissions) {
+		changes = append(changes, fmt.Sprintf("default_member_permissions: %s -> %s", marshalString(registered.DefaultMemberPermissions), marshalString(wanted.DefaultMemberPermissions)))
+	}
+	if registered.DMPermission != wanted.DMPermission {
+		changes = append(changes, fmt.Sprintf("dm_permission: %t -> %t", registered.DMPermission, wanted.DMPermission))
+	}
+	if registered.NSFW != wanted.NSFW {
+		changes = append(changes, fmt.Sprintf("nsfw: %t -> %t", registered.NSFW, wanted.NSFW))
+	}
+
+	return append(changes, diffOptions(registered.Name, registered.Options, wanted.Options)...)
+}
+
+func diffOptions(path string, registered []optionSchema, wanted []optionSchema) []string {
+	var (
+		changes         []string
+		registeredNames = map[string]optionSchema{}
+		wantedNames     = map[string]bool{}
+	)
+
+	for _, option := range registered {
+		registeredNames[option.Name] = option
+	}
+
+	for i, option := range wanted {
+		optionPath := path + " " + option.Name
+		wantedNames[option.Name] = true
+
+		old, ok := registeredNames[option.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ %s", optionPath))
+			continue
+		}
+
+		oldChildren, newChildren := old.Options, option.Options
+		old.Options, option.Options = nil, nil
+
+		if marshalString(old) != marshalString(option) {
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", optionPath, marshalString(old), marshalString(option)))
+		} else if i < len(registered) && registered[i].Name != option.Name {
+			changes = append(changes, fmt.Sprintf("~ %s: moved to position %d", optionPath, i))
+		}
+
+		changes = append(changes, diffOptions(optionPath, oldChildren, newChildren)...)
+	}
+
+	for _, option := range registered {
+		if !wantedNames[option.Name] {
+			changes = append(changes, fmt.Sprintf("- %s %s", path, option.Name))
+		}
+	}
+
+	return changes
+}
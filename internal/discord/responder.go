@@ -0,0 +1,65 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/common/utils"
+)
+
+var ErrAlreadyResponded = errors.New("interaction has already been responded to")
+
+// EditTimeout bounds editing a deferred response from a background job, the
+// job's context may already be cancelled by then.
+const EditTimeout = 10 * time.Second
+
+// Responder answers an interaction. Exactly one of Reply, Ephemeral, Error,
+// Respond, Defer and UpdateMessage can be used as the initial response, after
+// which FollowUp and EditOriginal can be used to send more.
+type Responder interface {
+	// Reply sends a message everyone in the channel can see.
+	Reply(msg string) error
+	// Ephemeral sends a message only the invoking user can see.
+	Ephemeral(msg string) error
+	// Error sends an ephemeral message styled as an error.
+	Error(msg string) error
+	// Respond sends a message built by the caller.
+	Respond(data discordgo.InteractionResponseData) error
+	// Defer acknowledges the interaction, showing a loading state until
+	// EditOriginal is used.
+	Defer(ephemeral bool) error
+	// UpdateMessage edits the message a component is attached to.
+	UpdateMessage(data discordgo.InteractionResponseData) error
+	FollowUp(ctx context.Context, params discordgo.WebhookParams) (*discordgo.Message, error)
+	EditOriginal(ctx context.Context, edit discordgo.WebhookEdit) error
+}
+
+// messageData builds the same embed utils.SendResponse does.
+func messageData(msg string, ephemeral bool, isError bool) discordgo.InteractionResponseData {
+	var flags discordgo.MessageFlags
+	if ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+
+	return discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{utils.CreateEmbed(&discordgo.MessageEmbed{Description: msg}, isError)},
+		Flags:  flags,
+	}
+}
+
+// MessageEdit replaces a deferred response with the embed Reply, or Error
+// when isError, would have sent.
+func MessageEdit(msg string, isError bool) discordgo.WebhookEdit {
+	embeds := messageData(msg, false, isError).Embeds
+	return discordgo.WebhookEdit{Embeds: &embeds}
+}
+
+func deferredResponse(ephemeral bool) discordgo.InteractionResponse {
+	response := discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredChannelMessageWithSource}
+	if ephemeral {
+		response.Data = &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	}
+	return response
+}
@@ -0,0 +1,78 @@
+package discord
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+)
+
+// HTTPResponder sends the initial response as the body of Discord's
+// interaction request and anything after it through the interaction webhook.
+type HTTPResponder struct {
+	c           echo.Context
+	client      rest.Client
+	interaction discordgo.Interaction
+}
+
+func (h *HTTPResponder) Reply(msg string) error {
+	return h.Respond(messageData(msg, false, false))
+}
+
+func (h *HTTPResponder) Ephemeral(msg string) error {
+	return h.Respond(messageData(msg, true, false))
+}
+
+func (h *HTTPResponder) Error(msg string) error {
+	return h.Respond(messageData(msg, true, true))
+}
+
+func (h *HTTPResponder) Respond(data discordgo.InteractionResponseData) error {
+	return h.respond(discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &data})
+}
+
+// Defer flushes the acknowledgement straight away. Work done afterwards should
+// not keep the request open for long, Discord may not read the response until
+// the request completes.
+func (h *HTTPResponder) Defer(ephemeral bool) error {
+	if err := h.respond(deferredResponse(ephemeral)); err != nil {
+		return err
+	}
+
+	h.c.Response().Flush()
+	return nil
+}
+
+func (h *HTTPResponder) UpdateMessage(data discordgo.InteractionResponseData) error {
+	return h.respond(discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage, Data: &data})
+}
+
+func (h *HTTPResponder) FollowUp(ctx context.Context, params discordgo.WebhookParams) (*discordgo.Message, error) {
+	return h.client.CreateFollowupMessage(ctx, h.interaction.AppID, h.interaction.Token, params)
+}
+
+func (h *HTTPResponder) EditOriginal(ctx context.Context, edit discordgo.WebhookEdit) error {
+	return h.client.EditOriginalResponse(ctx, h.interaction.AppID, h.interaction.Token, edit)
+}
+
+// Responded reports whether the initial response has been sent.
+func (h *HTTPResponder) Responded() bool {
+	return h.c.Response().Committed
+}
+
+func (h *HTTPResponder) respond(response discordgo.InteractionResponse) error {
+	if h.Responded() {
+		return ErrAlreadyResponded
+	}
+	return h.c.JSON(http.StatusOK, response)
+}
+
+func NewHTTPResponder(c echo.Context, client rest.Client, interaction discordgo.Interaction) *HTTPResponder {
+	return &HTTPResponder{
+		c:           c,
+		client:      client,
+		interaction: interaction,
+	}
+}
@@ -0,0 +1,78 @@
+package discord
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// RecordingResponder keeps everything sent to it, for tests.
+type RecordingResponder struct {
+	mu        sync.Mutex
+	Response  *discordgo.InteractionResponse
+	FollowUps []discordgo.WebhookParams
+	Edits     []discordgo.WebhookEdit
+}
+
+func (r *RecordingResponder) Reply(msg string) error {
+	return r.Respond(messageData(msg, false, false))
+}
+
+func (r *RecordingResponder) Ephemeral(msg string) error {
+	return r.Respond(messageData(msg, true, false))
+}
+
+func (r *RecordingResponder) Error(msg string) error {
+	return r.Respond(messageData(msg, true, true))
+}
+
+func (r *RecordingResponder) Respond(data discordgo.InteractionResponseData) error {
+	return r.respond(discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &data})
+}
+
+func (r *RecordingResponder) Defer(ephemeral bool) error {
+	return r.respond(deferredResponse(ephemeral))
+}
+
+func (r *RecordingResponder) UpdateMessage(data discordgo.InteractionResponseData) error {
+	return r.respond(discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage, Data: &data})
+}
+
+func (r *RecordingResponder) FollowUp(ctx context.Context, params discordgo.WebhookParams) (*discordgo.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FollowUps = append(r.FollowUps, params)
+	return &discordgo.Message{Content: params.Content, Embeds: params.Embeds}, nil
+}
+
+func (r *RecordingResponder) EditOriginal(ctx context.Context, edit discordgo.WebhookEdit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Edits = append(r.Edits, edit)
+	return nil
+}
+
+// Embed returns the first embed of the initial response, or nil.
+func (r *RecordingResponder) Embed() *discordgo.MessageEmbed {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Response == nil || r.Response.Data == nil || len(r.Response.Data.Embeds) == 0 {
+		return nil
+	}
+	return r.Response.Data.Embeds[0]
+}
+
+func (r *RecordingResponder) respond(response discordgo.InteractionResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Response != nil {
+		return ErrAlreadyResponded
+	}
+	r.Response = &response
+	return nil
+}
@@ -0,0 +1,279 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/worker/internal/metrics"
+)
+
+type Error struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s returned %d: %s", e.Method, e.Endpoint, e.StatusCode, e.Body)
+}
+
+const (
+	// DefaultMaxRetries is how many times a request is retried after being
+	// rate limited or failing with a server error before giving up.
+	DefaultMaxRetries = 5
+	// maxRetryAfter is the longest a rate limited request will wait to be
+	// retried, anything longer is returned as an error straight away.
+	maxRetryAfter = time.Minute
+	baseBackoff   = 250 * time.Millisecond
+	maxBackoff    = 10 * time.Second
+)
+
+// Client calls the Discord REST API. Endpoints are given as the full URLs
+// discordgo builds (e.g. discordgo.EndpointUser), they are rewritten to the
+// client's base URL so the API can be pointed somewhere else in tests.
+//
+// Requests wait for their route's rate limit bucket and the bot's global
+// limit, and are retried with backoff when rate limited or when Discord has
+// a server error. Clients derived with WithToken share their limits with the
+// client they came from, so one client should be created for the worker.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	limiter    *limiter
+	maxRetries int
+}
+
+// WithToken returns a copy of the client that authenticates as another bot.
+func (c Client) WithToken(token string) Client {
+	c.token = token
+	return c
+}
+
+func (c Client) Do(ctx context.Context, method string, endpoint string, body any, out any) error {
+	return c.do(ctx, method, endpoint, nil, body, out)
+}
+
+func (c Client) do(ctx context.Context, method string, endpoint string, header http.Header, body any, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	var (
+		r   = newRoute(method, strings.TrimPrefix(endpoint, discordgo.EndpointAPI))
+		url = c.url(endpoint)
+	)
+
+	for attempt := 0; ; attempt++ {
+		resp, respBody, err := c.send(ctx, r, method, url, header, data)
+
+		wait, reason := c.retryAfter(r, method, resp, respBody, err, attempt)
+		if reason == "" {
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return &Error{Method: method, Endpoint: url, StatusCode: resp.StatusCode, Body: string(respBody)}
+			}
+			if out != nil && len(respBody) > 0 {
+				return json.Unmarshal(respBody, out)
+			}
+			return nil
+		}
+
+		metrics.DiscordRetries.WithLabelValues(r.name, reason).Inc()
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// send makes one attempt at a request once its rate limits allow it.
+func (c Client) send(ctx context.Context, r route, method string, url string, header http.Header, data []byte) (*http.Response, []byte, error) {
+	var reqBody io.Reader
+	if data != nil {
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Interaction webhooks are authorised by the interaction token in the URL
+	if c.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bot %s", c.token))
+	}
+
+	if c.limiter != nil {
+		b, routeKey, waited, err := c.limiter.acquire(ctx, c.token, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		metrics.DiscordRateLimitWait.WithLabelValues(r.name).Observe(waited.Seconds())
+
+		var released http.Header
+		defer func() { c.limiter.release(b, routeKey, released) }()
+
+		resp, body, err := c.roundTrip(r, req)
+		if resp != nil {
+			released = resp.Header
+		}
+		return resp, body, err
+	}
+
+	return c.roundTrip(r, req)
+}
+
+func (c Client) roundTrip(r route, req *http.Request) (*http.Response, []byte, error) {
+	start := time.Now()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		metrics.DiscordRequests.WithLabelValues(r.name, "error").Inc()
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	metrics.DiscordRequests.WithLabelValues(r.name, strconv.Itoa(resp.StatusCode)).Inc()
+	metrics.DiscordRequestDuration.WithLabelValues(r.name).Observe(time.Since(start).Seconds())
+
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+// retryAfter decides whether an attempt should be retried, returning how
+// long to wait first and the reason, or an empty reason to give up.
+func (c Client) retryAfter(r route, method string, resp *http.Response, body []byte, err error, attempt int) (time.Duration, string) {
+	if attempt >= c.maxRetries {
+		return 0, ""
+	}
+
+	if err != nil {
+		// The request may have been made, only repeat it if that is safe
+		if method == http.MethodPost || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, ""
+		}
+		return backoff(attempt), "error"
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		var limited struct {
+			RetryAfter float64 `json:"retry_after"`
+			Global     bool    `json:"global"`
+		}
+		_ = json.Unmarshal(body, &limited)
+
+		wait := time.Duration(limited.RetryAfter * float64(time.Second))
+		if wait <= 0 {
+			if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+				wait = time.Duration(seconds * float64(time.Second))
+			}
+		}
+
+		scope := resp.Header.Get("X-RateLimit-Scope")
+		if limited.Global || resp.Header.Get("X-RateLimit-Global") == "true" {
+			scope = "global"
+			if c.limiter != nil {
+				c.limiter.limitGlobally(c.token, wait)
+			}
+		}
+		if scope == "" {
+			scope = "user"
+		}
+		metrics.DiscordRateLimited.WithLabelValues(r.name, scope).Inc()
+
+		if wait > maxRetryAfter {
+			return 0, ""
+		}
+		return wait, "rate_limited"
+	case resp.StatusCode >= 500 && method != http.MethodPost:
+		return backoff(attempt), "server_error"
+	}
+
+	return 0, ""
+}
+
+func backoff(attempt int) time.Duration {
+	wait := baseBackoff << attempt
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	// Up to 20% jitter so retries from many requests spread out
+	return wait - time.Duration(rand.Int63n(int64(wait)/5))
+}
+
+func (c Client) url(endpoint string) string {
+	if c.baseURL == "" || !strings.HasPrefix(endpoint, discordgo.EndpointAPI) {
+		return endpoint
+	}
+	return c.baseURL + strings.TrimPrefix(endpoint, discordgo.EndpointAPI)
+}
+
+func commandsEndpoint(applicationId string, guildId string) string {
+	if guildId != "" {
+		return discordgo.EndpointApplicationGuildCommands(applicationId, guildId)
+	}
+	return discordgo.EndpointApplicationGlobalCommands(applicationId)
+}
+
+func commandEndpoint(applicationId string, guildId string, commandId string) string {
+	if guildId != "" {
+		return discordgo.EndpointApplicationGuildCommand(applicationId, guildId, commandId)
+	}
+	return discordgo.EndpointApplicationGlobalCommand(applicationId, commandId)
+}
+
+func (c Client) ListCommands(ctx context.Context, applicationId string, guildId string) ([]discordgo.ApplicationCommand, error) {
+	var commands []discordgo.ApplicationCommand
+	if err := c.Do(ctx, http.MethodGet, commandsEndpoint(applicationId, guildId), nil, &commands); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+func (c Client) CreateCommand(ctx context.Context, applicationId string, guildId string, command discordgo.ApplicationCommand) error {
+	return c.Do(ctx, http.MethodPost, commandsEndpoint(applicationId, guildId), command, nil)
+}
+
+func (c Client) EditCommand(ctx context.Context, applicationId string, guildId string, commandId string, command discordgo.ApplicationCommand) error {
+	return c.Do(ctx, http.MethodPatch, commandEndpoint(applicationId, guildId, commandId), command, nil)
+}
+
+func (c Client) DeleteCommand(ctx context.Context, applicationId string, guildId string, commandId string) error {
+	return c.Do(ctx, http.MethodDelete, commandEndpoint(applicationId, guildId, commandId), nil, nil)
+}
+
+// NewClient creates a client for the API at baseURL, which should end in a
+// slash like discordgo.EndpointAPI. An empty token is allowed for the
+// interaction webhooks, which are authorised by the token in their URL.
+func NewClient(baseURL string, token string) Client {
+	return Client{
+		baseURL:    baseURL,
+		token:      token,
+		limiter:    newLimiter(),
+		maxRetries: DefaultMaxRetries,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
@@ -0,0 +1,207 @@
+package rest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/discord/rest/resttest"
+)
+
+func TestCurrentUser(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.Respond(http.MethodGet, "users/@me", http.StatusOK, discordgo.User{ID: "1", Username: "Levels", Discriminator: "0001"})
+
+	user, err := server.Client("token").CurrentUser(context.Background())
+	if err != nil {
+		t.Fatalf("getting current user: %s", err)
+	}
+	if user.ID != "1" || user.Username != "Levels" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	calls := server.CallsTo(http.MethodGet, "users/@me")
+	if len(calls) != 1 || calls[0].Header.Get("Authorization") != "Bot token" {
+		t.Errorf("expected one call authorised as the bot, got %+v", calls)
+	}
+}
+
+func TestAddGuildMemberRole(t *testing.T) {
+	const path = "guilds/1/members/2/roles/3"
+
+	server := resttest.NewServer(t)
+	server.Respond(http.MethodPut, path, http.StatusNoContent, nil)
+
+	if err := server.Client("token").AddGuildMemberRole(context.Background(), "1", "2", "3", "Level 5 reached"); err != nil {
+		t.Fatalf("adding role: %s", err)
+	}
+
+	calls := server.CallsTo(http.MethodPut, path)
+	if len(calls) != 1 || calls[0].Header.Get("X-Audit-Log-Reason") != "Level%205%20reached" {
+		t.Errorf("expected one call with an audit log reason, got %+v", calls)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		setup  func(server *resttest.Server)
+		status int
+	}{
+		{
+			name:   "missing permissions",
+			method: http.MethodGet,
+			setup:  func(server *resttest.Server) { server.Forbid(http.MethodGet, "users/@me") },
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "rate limited for too long to wait",
+			method: http.MethodGet,
+			setup:  func(server *resttest.Server) { server.RateLimit(http.MethodGet, "users/@me", 2*time.Minute, 0) },
+			status: http.StatusTooManyRequests,
+		},
+		{
+			name:   "server error on a POST",
+			method: http.MethodPost,
+			setup: func(server *resttest.Server) {
+				server.Respond(http.MethodPost, "users/@me", http.StatusBadGateway, nil)
+			},
+			status: http.StatusBadGateway,
+		},
+		{
+			name:   "unknown route",
+			method: http.MethodGet,
+			setup:  func(server *resttest.Server) {},
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := resttest.NewServer(t)
+			tt.setup(server)
+
+			err := server.Client("token").Do(context.Background(), tt.method, discordgo.EndpointUser("@me"), nil, nil)
+
+			var restErr *rest.Error
+			if !errors.As(err, &restErr) || restErr.StatusCode != tt.status {
+				t.Errorf("expected a %d error, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetried(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.RateLimit(http.MethodGet, "users/@me", 10*time.Millisecond, 2)
+	server.Respond(http.MethodGet, "users/@me", http.StatusOK, discordgo.User{ID: "1"})
+
+	if _, err := server.Client("token").CurrentUser(context.Background()); err != nil {
+		t.Fatalf("expected the request to be retried until it succeeded, got %s", err)
+	}
+
+	if calls := server.CallsTo(http.MethodGet, "users/@me"); len(calls) != 3 {
+		t.Errorf("expected 3 calls, got %d", len(calls))
+	}
+}
+
+func TestRateLimitRetriesExhausted(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.RateLimit(http.MethodGet, "users/@me", time.Millisecond, 0)
+
+	_, err := server.Client("token").CurrentUser(context.Background())
+
+	var restErr *rest.Error
+	if !errors.As(err, &restErr) || restErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429 error, got %v", err)
+	}
+	if calls := server.CallsTo(http.MethodGet, "users/@me"); len(calls) != rest.DefaultMaxRetries+1 {
+		t.Errorf("expected %d calls, got %d", rest.DefaultMaxRetries+1, len(calls))
+	}
+}
+
+func TestServerErrorRetried(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.RespondOnce(http.MethodGet, "users/@me", http.StatusBadGateway, nil)
+	server.Respond(http.MethodGet, "users/@me", http.StatusOK, discordgo.User{ID: "1"})
+
+	if _, err := server.Client("token").CurrentUser(context.Background()); err != nil {
+		t.Fatalf("expected the request to be retried, got %s", err)
+	}
+}
+
+func TestBucketWaitedFor(t *testing.T) {
+	const (
+		limit  = 2
+		window = 100 * time.Millisecond
+	)
+
+	server := resttest.NewServer(t)
+	server.Bucket(http.MethodPut, "guilds/1/members/2/roles/3", limit, window)
+	server.Respond(http.MethodPut, "guilds/1/members/2/roles/3", http.StatusNoContent, nil)
+
+	client := server.Client("token")
+	start := time.Now()
+	for n := 0; n < 2*limit+1; n++ {
+		if err := client.AddGuildMemberRole(context.Background(), "1", "2", "3", ""); err != nil {
+			t.Fatalf("adding role %d: %s", n, err)
+		}
+	}
+
+	for _, call := range server.Calls() {
+		if call.Status == http.StatusTooManyRequests {
+			t.Fatalf("expected the client to wait for the bucket instead of being rate limited")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*window-10*time.Millisecond {
+		t.Errorf("expected the requests to be spread over 3 windows, took %s", elapsed)
+	}
+}
+
+func TestGlobalRateLimit(t *testing.T) {
+	const retryAfter = 100 * time.Millisecond
+
+	server := resttest.NewServer(t)
+	server.GlobalRateLimit(http.MethodGet, "users/@me", retryAfter, 1)
+	server.Respond(http.MethodGet, "users/@me", http.StatusOK, discordgo.User{ID: "1"})
+	server.Respond(http.MethodPut, "guilds/1/members/2/roles/3", http.StatusNoContent, nil)
+
+	client := server.Client("token")
+
+	done := make(chan error)
+	go func() {
+		_, err := client.CurrentUser(context.Background())
+		done <- err
+	}()
+
+	for len(server.Calls()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if err := client.AddGuildMemberRole(context.Background(), "1", "2", "3", ""); err != nil {
+		t.Fatalf("adding role: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < retryAfter/2 {
+		t.Errorf("expected other routes to wait for the global limit, took %s", elapsed)
+	}
+
+	// Other bots have their own global limit
+	start = time.Now()
+	if err := client.WithToken("other").AddGuildMemberRole(context.Background(), "1", "2", "3", ""); err != nil {
+		t.Fatalf("adding role as another bot: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > retryAfter/2 {
+		t.Errorf("expected other bots not to wait, took %s", elapsed)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected the rate limited request to be retried, got %s", err)
+	}
+}
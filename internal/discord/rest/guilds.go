@@ -0,0 +1,20 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// AddGuildMemberRole gives a member a role, recording reason in the guild's
+// audit log.
+func (c Client) AddGuildMemberRole(ctx context.Context, guildId string, userId string, roleId string, reason string) error {
+	header := http.Header{}
+	if reason != "" {
+		header.Set("X-Audit-Log-Reason", url.PathEscape(reason))
+	}
+
+	return c.do(ctx, http.MethodPut, discordgo.EndpointGuildMemberRole(guildId, userId, roleId), header, nil, nil)
+}
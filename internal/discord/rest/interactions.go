@@ -0,0 +1,20 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (c Client) CreateFollowupMessage(ctx context.Context, applicationId string, token string, params discordgo.WebhookParams) (*discordgo.Message, error) {
+	var message discordgo.Message
+	if err := c.Do(ctx, http.MethodPost, discordgo.EndpointFollowupMessage(applicationId, token)+"?wait=true", params, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (c Client) EditOriginalResponse(ctx context.Context, applicationId string, token string, edit discordgo.WebhookEdit) error {
+	return c.Do(ctx, http.MethodPatch, discordgo.EndpointInteractionResponseActions(applicationId, token), edit, nil)
+}
@@ -0,0 +1,250 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// route identifies what a request is rate limited by. Discord limits each
+// bot per route, with the top level guild, channel or webhook (the major
+// parameter) counted separately.
+type route struct {
+	// name is the method and path with IDs and tokens replaced, it is used
+	// as the metrics label.
+	name  string
+	major string
+}
+
+// newRoute builds the route for path, which is relative to the API base
+// (e.g. "guilds/1/members/2/roles/3").
+func newRoute(method string, path string) route {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	var (
+		segments = strings.Split(strings.Trim(path, "/"), "/")
+		major    string
+	)
+
+	for n := range segments {
+		switch {
+		case n > 0 && (segments[n-1] == "webhooks" || segments[n-1] == "interactions") && n+1 < len(segments) && isId(segments[n]):
+			// The next segment is the webhook or interaction token
+			if n == 1 {
+				major = segments[n] + "/" + segments[n+1]
+			}
+			segments[n+1] = ":token"
+			segments[n] = ":id"
+		case n == 1 && (segments[0] == "guilds" || segments[0] == "channels") && isId(segments[n]):
+			major = segments[n]
+			segments[n] = ":id"
+		case isId(segments[n]):
+			segments[n] = ":id"
+		}
+	}
+
+	return route{name: method + " /" + strings.Join(segments, "/"), major: major}
+}
+
+func isId(segment string) bool {
+	_, err := strconv.ParseUint(segment, 10, 64)
+	return err == nil
+}
+
+// pruneInterval is how often buckets that have reset are forgotten. Every
+// interaction has buckets of its own, so they can't be kept forever.
+const pruneInterval = time.Minute
+
+type bucket struct {
+	// mu is held from acquiring the bucket until the response's rate limit
+	// headers have been read, so requests in a bucket go one at a time.
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+	// users is how many requests are using the bucket, it is guarded by the
+	// limiter's mu. Buckets in use are not pruned.
+	users int
+}
+
+// routeKey is a route as used by one bot.
+type routeKey struct {
+	token string
+	name  string
+}
+
+type bucketKey struct {
+	token string
+	// id is the bucket hash, or the route name until Discord has sent one.
+	id    string
+	major string
+}
+
+// limiter tracks the rate limits of every bot using clients derived from the
+// same NewClient call.
+type limiter struct {
+	mu sync.Mutex
+	// hashes maps a bot's route to the bucket Discord said it belongs to,
+	// routes sharing a bucket share its limit.
+	hashes  map[routeKey]string
+	buckets map[bucketKey]*bucket
+	// global is when each bot's global limit resets.
+	global map[string]time.Time
+	pruned time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		hashes:  map[routeKey]string{},
+		buckets: map[bucketKey]*bucket{},
+		global:  map[string]time.Time{},
+		pruned:  time.Now(),
+	}
+}
+
+func (l *limiter) bucket(token string, r route) (*bucket, routeKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now := time.Now(); now.Sub(l.pruned) >= pruneInterval {
+		l.prune(now)
+	}
+
+	key := routeKey{token: token, name: r.name}
+	id := bucketKey{token: token, id: r.name, major: r.major}
+	if hash, ok := l.hashes[key]; ok {
+		id.id = hash
+	}
+
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{remaining: 1}
+		l.buckets[id] = b
+	}
+	b.users++
+
+	return b, key
+}
+
+// prune forgets buckets that aren't in use and have reset, which are the same
+// as a new bucket, along with the bucket hashes and global limits of bots
+// that have none left. l.mu must be held.
+func (l *limiter) prune(now time.Time) {
+	l.pruned = now
+
+	tokens := map[string]bool{}
+	for id, b := range l.buckets {
+		if b.users == 0 && now.After(b.reset) {
+			delete(l.buckets, id)
+			continue
+		}
+		tokens[id.token] = true
+	}
+
+	for key := range l.hashes {
+		if !tokens[key.token] {
+			delete(l.hashes, key)
+		}
+	}
+
+	for token, reset := range l.global {
+		if now.After(reset) {
+			delete(l.global, token)
+		}
+	}
+}
+
+// done marks a request as no longer using the bucket.
+func (l *limiter) done(b *bucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b.users--
+}
+
+// acquire waits until a request can be made on the route, returning the
+// bucket to release with the response headers and how long it waited.
+func (l *limiter) acquire(ctx context.Context, token string, r route) (*bucket, routeKey, time.Duration, error) {
+	start := time.Now()
+	b, key := l.bucket(token, r)
+
+	b.mu.Lock()
+
+	wait := time.Until(b.reset)
+	if b.remaining > 0 || wait <= 0 {
+		wait = 0
+	}
+
+	l.mu.Lock()
+	if global := time.Until(l.global[token]); global > wait {
+		wait = global
+	}
+	l.mu.Unlock()
+
+	if err := sleep(ctx, wait); err != nil {
+		b.mu.Unlock()
+		l.done(b)
+		return nil, routeKey{}, 0, err
+	}
+
+	return b, key, time.Since(start), nil
+}
+
+// release records the rate limit headers of a response and lets the next
+// request in the bucket go. header is nil when no response was received.
+func (l *limiter) release(b *bucket, key routeKey, header http.Header) {
+	defer l.done(b)
+	defer b.mu.Unlock()
+
+	if header == nil {
+		return
+	}
+
+	if hash := header.Get("X-RateLimit-Bucket"); hash != "" {
+		l.mu.Lock()
+		l.hashes[key] = hash
+		l.mu.Unlock()
+	}
+
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		b.remaining = remaining
+	} else {
+		// Routes without limits, stay open
+		b.remaining = 1
+	}
+
+	if resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		b.reset = time.Now().Add(time.Duration(resetAfter * float64(time.Second)))
+	}
+}
+
+// limitGlobally stops every request made as the bot until retryAfter has
+// passed.
+func (l *limiter) limitGlobally(token string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if reset := time.Now().Add(retryAfter); reset.After(l.global[token]) {
+		l.global[token] = reset
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
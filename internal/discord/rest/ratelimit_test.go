@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewRoute(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   route
+	}{
+		{http.MethodGet, "users/@me", route{name: "GET /users/@me"}},
+		{http.MethodPut, "guilds/1/members/2/roles/3", route{name: "PUT /guilds/:id/members/:id/roles/:id", major: "1"}},
+		{http.MethodGet, "channels/4/messages?limit=10", route{name: "GET /channels/:id/messages", major: "4"}},
+		{http.MethodPatch, "webhooks/5/aW50ZXJhY3Rpb24/messages/@original", route{name: "PATCH /webhooks/:id/:token/messages/@original", major: "5/aW50ZXJhY3Rpb24"}},
+		{http.MethodPost, "interactions/6/aW50ZXJhY3Rpb24/callback", route{name: "POST /interactions/:id/:token/callback", major: "6/aW50ZXJhY3Rpb24"}},
+		{http.MethodGet, "applications/7/guilds/8/commands", route{name: "GET /applications/:id/guilds/:id/commands"}},
+	}
+
+	for _, tt := range tests {
+		if got := newRoute(tt.method, tt.path); got != tt.want {
+			t.Errorf("newRoute(%s, %s) = %+v, want %+v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterPrunes(t *testing.T) {
+	var (
+		l      = newLimiter()
+		ctx    = context.Background()
+		header = http.Header{}
+	)
+	header.Set("X-RateLimit-Bucket", "abc")
+	header.Set("X-RateLimit-Remaining", "4")
+	header.Set("X-RateLimit-Reset-After", "0")
+
+	// Every interaction gets buckets of its own
+	for _, token := range []string{"aW50ZXJhY3Rpb24", "b3RoZXI"} {
+		b, key, _, err := l.acquire(ctx, "", newRoute(http.MethodPatch, "webhooks/5/"+token+"/messages/@original"))
+		if err != nil {
+			t.Fatalf("acquiring: %s", err)
+		}
+		l.release(b, key, header)
+	}
+
+	inUse, _, _, err := l.acquire(ctx, "bot", newRoute(http.MethodGet, "users/@me"))
+	if err != nil {
+		t.Fatalf("acquiring: %s", err)
+	}
+
+	if len(l.buckets) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(l.buckets))
+	}
+
+	l.pruned = time.Now().Add(-pruneInterval)
+	l.bucket("bot", newRoute(http.MethodGet, "users/@me"))
+
+	if len(l.buckets) != 1 || l.buckets[bucketKey{token: "bot", id: "GET /users/@me"}] != inUse {
+		t.Errorf("expected only the bucket in use to be kept, got %+v", l.buckets)
+	}
+	if len(l.hashes) != 0 {
+		t.Errorf("expected the bucket hashes of the interactions to be forgotten, got %+v", l.hashes)
+	}
+}
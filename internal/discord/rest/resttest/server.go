@@ -0,0 +1,279 @@
+// Package resttest runs a stand-in for the Discord REST API that records the
+// calls made to it, so code using rest.Client can be tested and interactions
+// replayed offline.
+package resttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prosperitybot/worker/internal/discord/rest"
+)
+
+// Call is a request made to the server. Path is relative to the API base,
+// e.g. "users/@me".
+type Call struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+	// Status is the status code the call was answered with.
+	Status int
+}
+
+// Decode unmarshals the JSON body of the call into v.
+func (c Call) Decode(v any) error {
+	return json.Unmarshal(c.Body, v)
+}
+
+type reply struct {
+	status int
+	header http.Header
+	body   any
+	// times is how many calls the reply is used for before falling through
+	// to the next one, zero meaning every call.
+	times int
+}
+
+type bucket struct {
+	limit     int
+	window    time.Duration
+	remaining int
+	reset     time.Time
+}
+
+// Server answers each route with the replies registered for it, in order.
+// Routes without a reply get a 404 like unknown routes on Discord.
+type Server struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	replies map[string][]*reply
+	buckets map[string]*bucket
+	calls   []Call
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := strings.TrimPrefix(r.URL.Path, "/api/v9/")
+
+	s.mu.Lock()
+	next, header := s.limit(r.Method, path)
+	if next == nil {
+		next = s.next(r.Method, path)
+	}
+	if next == nil {
+		next = &reply{status: http.StatusNotFound, body: map[string]any{"message": "404: Not Found", "code": 0}}
+	}
+	s.calls = append(s.calls, Call{Method: r.Method, Path: path, Header: r.Header.Clone(), Body: body, Status: next.status})
+	s.mu.Unlock()
+
+	for key := range next.header {
+		header.Set(key, next.header.Get(key))
+	}
+	writeJSON(w, next.status, header, next.body)
+}
+
+// limit applies the route's bucket, returning a 429 reply when it is
+// exhausted and the rate limit headers to send with any other reply.
+func (s *Server) limit(method string, path string) (*reply, http.Header) {
+	header := http.Header{}
+
+	b, ok := s.buckets[method+" "+path]
+	if !ok {
+		return nil, header
+	}
+
+	now := time.Now()
+	if now.After(b.reset) {
+		b.remaining = b.limit
+		b.reset = now.Add(b.window)
+	}
+
+	resetAfter := b.reset.Sub(now)
+	if b.remaining == 0 {
+		return rateLimited(resetAfter, false), header
+	}
+
+	b.remaining--
+	header.Set("X-RateLimit-Limit", strconv.Itoa(b.limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(b.remaining))
+	header.Set("X-RateLimit-Reset-After", seconds(resetAfter))
+	header.Set("X-RateLimit-Bucket", method+" "+path)
+
+	return nil, header
+}
+
+func (s *Server) next(method string, path string) *reply {
+	key := method + " " + path
+
+	replies := s.replies[key]
+	if len(replies) == 0 {
+		return nil
+	}
+
+	next := replies[0]
+	if next.times > 0 {
+		next.times--
+		if next.times == 0 {
+			s.replies[key] = replies[1:]
+		}
+	}
+
+	return next
+}
+
+func (s *Server) add(method string, path string, r *reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := method + " " + path
+	s.replies[key] = append(s.replies[key], r)
+}
+
+// Respond answers every call to the route with status and body encoded as
+// JSON. A nil body sends no content.
+func (s *Server) Respond(method string, path string, status int, body any) {
+	s.add(method, path, &reply{status: status, body: body})
+}
+
+// RespondOnce answers the next call to the route, later calls get the replies
+// registered after it.
+func (s *Server) RespondOnce(method string, path string, status int, body any) {
+	s.add(method, path, &reply{status: status, body: body, times: 1})
+}
+
+// RateLimit answers the next times calls to the route with a 429 asking the
+// caller to retry after retryAfter. Zero times rate limits every call.
+func (s *Server) RateLimit(method string, path string, retryAfter time.Duration, times int) {
+	r := rateLimited(retryAfter, false)
+	r.times = times
+	s.add(method, path, r)
+}
+
+// GlobalRateLimit is RateLimit for the bot's global limit, which applies to
+// every route.
+func (s *Server) GlobalRateLimit(method string, path string, retryAfter time.Duration, times int) {
+	r := rateLimited(retryAfter, true)
+	r.times = times
+	s.add(method, path, r)
+}
+
+// Bucket limits the route to limit calls in each window, sending the rate
+// limit headers Discord does. Calls over the limit get a 429 before any other
+// reply is used.
+func (s *Server) Bucket(method string, path string, limit int, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buckets[method+" "+path] = &bucket{limit: limit, window: window}
+}
+
+func rateLimited(retryAfter time.Duration, global bool) *reply {
+	header := http.Header{}
+	header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	header.Set("X-RateLimit-Scope", "user")
+	if global {
+		header.Set("X-RateLimit-Global", "true")
+		header.Set("X-RateLimit-Scope", "global")
+	} else {
+		header.Set("X-RateLimit-Remaining", "0")
+		header.Set("X-RateLimit-Reset-After", seconds(retryAfter))
+	}
+
+	return &reply{
+		status: http.StatusTooManyRequests,
+		header: header,
+		body:   map[string]any{"message": "You are being rate limited.", "retry_after": retryAfter.Seconds(), "global": global},
+	}
+}
+
+// seconds formats d like Discord's rate limit headers, rounded up to the
+// millisecond so callers never retry early.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(math.Ceil(d.Seconds()*1000)/1000, 'f', 3, 64)
+}
+
+// Forbid answers every call to the route with the 403 Discord sends when the
+// bot is missing a permission.
+func (s *Server) Forbid(method string, path string) {
+	s.add(method, path, &reply{
+		status: http.StatusForbidden,
+		body:   map[string]any{"message": "Missing Permissions", "code": 50013},
+	})
+}
+
+// Calls returns every call made to the server so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call{}, s.calls...)
+}
+
+// CallsTo returns the calls made to a route.
+func (s *Server) CallsTo(method string, path string) []Call {
+	var calls []Call
+	for _, call := range s.Calls() {
+		if call.Method == method && call.Path == path {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// URL is the base URL of the API, to be given to rest.NewClient.
+func (s *Server) URL() string {
+	return s.server.URL + "/api/v9/"
+}
+
+// Client returns a client for the server authenticating with token.
+func (s *Server) Client(token string) rest.Client {
+	return rest.NewClient(s.URL(), token)
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// New starts a server, it must be closed once finished with.
+func New() *Server {
+	s := &Server{replies: map[string][]*reply{}, buckets: map[string]*bucket{}}
+	s.server = httptest.NewServer(s)
+
+	return s
+}
+
+// NewServer starts a server that is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := New()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, header http.Header, body any) {
+	for key := range header {
+		w.Header().Set(key, header.Get(key))
+	}
+
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		panic(fmt.Sprintf("resttest: encoding reply: %s", err))
+	}
+}
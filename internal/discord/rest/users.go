@@ -0,0 +1,17 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// CurrentUser returns the user of the bot the client authenticates as.
+func (c Client) CurrentUser(ctx context.Context) (*discordgo.User, error) {
+	var user discordgo.User
+	if err := c.Do(ctx, http.MethodGet, discordgo.EndpointUser("@me"), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
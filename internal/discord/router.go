@@ -0,0 +1,141 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/common/logger"
+	"go.uber.org/zap"
+)
+
+type route func(ctx context.Context, r Responder, i discordgo.Interaction, options []*discordgo.ApplicationCommandInteractionDataOption) error
+
+// Router dispatches a command to the handler registered for its subcommand
+// group and subcommand, so commands don't have to switch on option names
+// themselves.
+type Router struct {
+	routes map[string]route
+}
+
+// Handle registers handler for path, the space separated subcommand group and
+// subcommand names (e.g. "channels add"). The subcommand's options are bound
+// into T by name, see Bind.
+func Handle[T any](router Router, path string, handler func(ctx context.Context, r Responder, i discordgo.Interaction, options T)) {
+	router.routes[path] = func(ctx context.Context, r Responder, i discordgo.Interaction, options []*discordgo.ApplicationCommandInteractionDataOption) error {
+		bound, err := Bind[T](options)
+		if err != nil {
+			return err
+		}
+
+		handler(ctx, r, i, bound)
+		return nil
+	}
+}
+
+func (router Router) Execute(ctx context.Context, r Responder, i discordgo.Interaction) {
+	path, options := subCommand(i)
+
+	handler, ok := router.routes[strings.Join(path, " ")]
+	if !ok {
+		logger.Warn(ctx, "No handler for subcommand", zap.Strings("path", path))
+		r.Error("This command is not supported")
+		return
+	}
+
+	if err := handler(ctx, r, i, options); err != nil {
+		logger.Error(ctx, "Error reading command options", zap.Strings("path", path), zap.Error(err))
+		r.Error("The options given to this command were not valid")
+	}
+}
+
+func NewRouter() Router {
+	return Router{routes: map[string]route{}}
+}
+
+// Bind reads command options into the fields of T tagged with
+// `option:"<name>"`. Options that were not supplied leave their field at its
+// zero value, so optional options should use pointer fields. String fields
+// accept string options as well as the ID of user, channel, role and
+// mentionable options.
+func Bind[T any](options []*discordgo.ApplicationCommandInteractionDataOption) (T, error) {
+	var (
+		result T
+		value  = reflect.ValueOf(&result).Elem()
+	)
+
+	if value.Kind() != reflect.Struct {
+		return result, fmt.Errorf("options must be bound into a struct, got %s", value.Type())
+	}
+
+	byName := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, option := range options {
+		byName[option.Name] = option
+	}
+
+	for n := 0; n < value.NumField(); n++ {
+		name, ok := value.Type().Field(n).Tag.Lookup("option")
+		if !ok {
+			continue
+		}
+
+		option, ok := byName[name]
+		if !ok {
+			continue
+		}
+
+		field := value.Field(n)
+		if field.Kind() == reflect.Pointer {
+			field.Set(reflect.New(field.Type().Elem()))
+			field = field.Elem()
+		}
+
+		if err := setOption(field, option); err != nil {
+			return result, fmt.Errorf("option %s: %w", name, err)
+		}
+	}
+
+	return result, nil
+}
+
+func setOption(field reflect.Value, option *discordgo.ApplicationCommandInteractionDataOption) error {
+	switch field.Kind() {
+	case reflect.String:
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionString,
+			discordgo.ApplicationCommandOptionUser,
+			discordgo.ApplicationCommandOptionChannel,
+			discordgo.ApplicationCommandOptionRole,
+			discordgo.ApplicationCommandOptionMentionable:
+			if v, ok := option.Value.(string); ok {
+				field.SetString(v)
+				return nil
+			}
+		}
+	case reflect.Int, reflect.Int64:
+		if option.Type == discordgo.ApplicationCommandOptionInteger {
+			if v, ok := option.Value.(float64); ok {
+				field.SetInt(int64(v))
+				return nil
+			}
+		}
+	case reflect.Float64:
+		if option.Type == discordgo.ApplicationCommandOptionNumber || option.Type == discordgo.ApplicationCommandOptionInteger {
+			if v, ok := option.Value.(float64); ok {
+				field.SetFloat(v)
+				return nil
+			}
+		}
+	case reflect.Bool:
+		if option.Type == discordgo.ApplicationCommandOptionBoolean {
+			if v, ok := option.Value.(bool); ok {
+				field.SetBool(v)
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("cannot read %s option into %s", option.Type, field.Type())
+}
@@ -1,16 +1,61 @@
 package discord
 
 import (
+	"context"
+	"time"
+
 	"github.com/bwmarrin/discordgo"
-	"github.com/labstack/echo/v4"
 )
 
 type SlashCommand interface {
 	Command() discordgo.ApplicationCommand
-	Execute(c echo.Context, i discordgo.Interaction)
+	Execute(ctx context.Context, r Responder, i discordgo.Interaction)
 }
 
 type Component interface {
 	BaseComponent() discordgo.MessageComponent
-	Execute(c echo.Context, i discordgo.Interaction)
+	Execute(ctx context.Context, r Responder, i discordgo.Interaction)
+}
+
+// Mutating is implemented by commands and components that change data, so
+// that a redelivered interaction is answered with the original response rather
+// than being applied twice.
+type Mutating interface {
+	Mutates(i discordgo.Interaction) bool
+}
+
+type CooldownScope string
+
+const (
+	// CooldownUser limits each user separately.
+	CooldownUser CooldownScope = "user"
+	// CooldownChannel limits everyone in a channel together.
+	CooldownChannel CooldownScope = "channel"
+	// CooldownGuild limits everyone in a guild together, in DMs it limits
+	// each user.
+	CooldownGuild CooldownScope = "guild"
+)
+
+// Cooldown is how long must pass between uses of a command within its scope.
+type Cooldown struct {
+	Scope    CooldownScope
+	Duration time.Duration
+}
+
+// Limited is implemented by commands and components that can't be used again
+// until their cooldown has passed. Guilds can override the duration of a
+// command's cooldown with /settings cooldown.
+type Limited interface {
+	Cooldown() Cooldown
+}
+
+// Cooldowns returns the default cooldown of every limited command.
+func Cooldowns(commands map[string]SlashCommand) map[string]Cooldown {
+	cooldowns := map[string]Cooldown{}
+	for name, command := range commands {
+		if limited, ok := command.(Limited); ok {
+			cooldowns[name] = limited.Cooldown()
+		}
+	}
+	return cooldowns
 }
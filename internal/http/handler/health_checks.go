@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/discord/register"
+	"github.com/prosperitybot/worker/internal/migrate"
+)
+
+func DatabaseCheck(db *sqlx.DB) HealthCheck {
+	return HealthCheck{
+		Name: "database",
+		Check: func(ctx context.Context) (string, error) {
+			if err := db.PingContext(ctx); err != nil {
+				return "", err
+			}
+			stats := db.Stats()
+			return fmt.Sprintf("%d open, %d in use", stats.OpenConnections, stats.InUse), nil
+		},
+	}
+}
+
+func MigrationsCheck(migrator migrate.Migrator) HealthCheck {
+	return HealthCheck{
+		Name: "migrations",
+		Check: func(ctx context.Context) (string, error) {
+			version, err := migrator.Version(ctx)
+			if err != nil {
+				return "", err
+			}
+
+			detail := fmt.Sprintf("version %d, expected %d", version, migrator.Latest())
+			if version < migrator.Latest() {
+				return detail, errors.New("database schema is behind, run `worker migrate`")
+			}
+			return detail, nil
+		},
+	}
+}
+
+func CommandsCheck(registrar *register.Registrar, botId string) HealthCheck {
+	return HealthCheck{
+		Name: "commands",
+		Check: func(ctx context.Context) (string, error) {
+			synced, ok := registrar.LastSynced(botId)
+			if !ok {
+				return "", errors.New("commands have not been registered yet")
+			}
+			return fmt.Sprintf("synced %s ago", time.Since(synced).Round(time.Second)), nil
+		},
+	}
+}
+
+func PublicKeysCheck(mainPublicKey ed25519.PublicKey, publicKeys *cache.PublicKeyCache) HealthCheck {
+	return HealthCheck{
+		Name: "public_keys",
+		Check: func(ctx context.Context) (string, error) {
+			if len(mainPublicKey) != ed25519.PublicKeySize {
+				return "", errors.New("main bot public key is not loaded")
+			}
+			return fmt.Sprintf("%d whitelabel keys cached", publicKeys.Len()), nil
+		},
+	}
+}
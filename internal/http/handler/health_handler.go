@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
@@ -9,11 +13,37 @@ import (
 	"go.uber.org/zap"
 )
 
+const healthCheckTimeout = 2 * time.Second
+
+type HealthCheck struct {
+	Name string
+	// Check returns an optional human readable detail, or an error when the
+	// dependency is not usable.
+	Check func(ctx context.Context) (string, error)
+}
+
+type HealthStatus struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+type HealthCheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
 type HealthHandler struct {
-	Db *sqlx.DB
+	Db       *sqlx.DB
+	Draining *atomic.Bool
+	Checks   []HealthCheck
 }
 
 func (h HealthHandler) GETHealth(c echo.Context) error {
+	if h.Draining != nil && h.Draining.Load() {
+		return c.String(http.StatusServiceUnavailable, "Shutting down")
+	}
 
 	if err := h.Db.PingContext(c.Request().Context()); err != nil {
 		logger.Error(c.Request().Context(), "Error pinging database", zap.Error(err))
@@ -22,3 +52,61 @@ func (h HealthHandler) GETHealth(c echo.Context) error {
 
 	return c.String(http.StatusOK, "OK")
 }
+
+// GETLivez only reports whether the process is able to serve requests at all,
+// dependencies are deliberately not checked.
+func (h HealthHandler) GETLivez(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+func (h HealthHandler) GETReadyz(c echo.Context) error {
+	if h.Draining != nil && h.Draining.Load() {
+		return c.JSON(http.StatusServiceUnavailable, HealthStatus{Status: "draining"})
+	}
+
+	var (
+		status = HealthStatus{Status: "ok", Checks: make(map[string]HealthCheckResult, len(h.Checks))}
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+
+	for _, check := range h.Checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := check.Check(ctx)
+			result := HealthCheckResult{
+				Status:    "ok",
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Detail:    detail,
+			}
+
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			status.Checks[check.Name] = result
+			if err != nil {
+				status.Status = "fail"
+			}
+		}(check)
+	}
+
+	wg.Wait()
+
+	if status.Status != "ok" {
+		logger.Warn(c.Request().Context(), "Readiness check failed", zap.Any("checks", status.Checks))
+		return c.JSON(http.StatusServiceUnavailable, status)
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
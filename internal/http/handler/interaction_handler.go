@@ -2,21 +2,42 @@ package handler
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
 	"github.com/prosperitybot/common/utils"
+	"github.com/prosperitybot/worker/internal/cooldown"
 	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/customid"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/idempotency"
+	"github.com/prosperitybot/worker/internal/metrics"
+	"github.com/prosperitybot/worker/internal/tracing"
 	"go.uber.org/zap"
 )
 
 type InteractionHandler struct {
-	Commands   map[string]discord.SlashCommand
-	Components map[string]discord.Component
+	Commands    map[string]discord.SlashCommand
+	Components  map[string]discord.Component
+	Tracer      tracing.Tracer
+	Idempotency *idempotency.Store
+	// Cooldowns turns away limited commands and components used again too
+	// soon, nil turns cooldowns off.
+	Cooldowns *cooldown.Limiter
+	CustomIds customid.Codec
+	// Discord sends follow-ups and edits for deferred responses, it needs no
+	// bot token.
+	Discord rest.Client
 }
 
 func (h InteractionHandler) POSTInteractions(c echo.Context) error {
@@ -27,48 +48,232 @@ func (h InteractionHandler) POSTInteractions(c echo.Context) error {
 	}
 
 	var (
-		botId = c.Param("bot_id")
+		botId           = c.Param("bot_id")
+		start           = time.Now()
+		interactionType = "other"
+		name            = "unknown"
 	)
 
+	responder := discord.NewHTTPResponder(c, h.Discord, body)
+
+	ctx, span := h.Tracer.StartSpan(c.Request().Context(), "interaction")
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	defer func() {
+		span.SetTag("interaction.type", interactionType)
+		span.SetTag("interaction.name", name)
+		span.SetTag("interaction.id", body.ID)
+		span.SetTag("guild_id", body.GuildID)
+		span.SetTag("bot_id", botId)
+		span.End()
+
+		metrics.ObserveInteraction(interactionType, name, botId, time.Since(start))
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			recoverInteraction(c.Request().Context(), responder, body, interactionType, name, r, span)
+		}
+	}()
+
 	switch body.Type {
 	case discordgo.InteractionPing:
+		interactionType, name = "ping", "ping"
 		return c.JSON(http.StatusOK, discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponsePong,
 		})
 	case discordgo.InteractionApplicationCommand:
+		interactionType = "command"
 		c = addContextInfo(c, body, botId)
 
 		if cmd, v := h.Commands[body.ApplicationCommandData().Name]; !v {
 			return c.NoContent(404)
 		} else {
-			logger.Info(c.Request().Context(), fmt.Sprintf("Executing command /%s", cmd.Command().Name), zap.String("command", body.ApplicationCommandData().Name))
-			cmd.Execute(c, body)
+			name = body.ApplicationCommandData().Name
+			if body.GuildID == "" && discord.GuildOnly(cmd.Command()) {
+				responder.Error(fmt.Sprintf("/%s can only be used in a server", name))
+				return nil
+			}
+
+			return h.execute(c, responder, body, botId, interactionType, name, cmd, func() {
+				logger.Info(c.Request().Context(), fmt.Sprintf("Executing command /%s", cmd.Command().Name), zap.String("command", body.ApplicationCommandData().Name))
+				cmd.Execute(c.Request().Context(), responder, body)
+			})
 		}
-		break
 	case discordgo.InteractionMessageComponent:
+		interactionType = "component"
 		c = addContextInfo(c, body, botId)
 
-		if component, v := h.Components[body.MessageComponentData().CustomID]; !v {
-			splitString := strings.Split(body.MessageComponentData().CustomID, "_")
-			if comp, w := h.Components[splitString[0]]; !w {
-				return c.NoContent(404)
-			} else {
-				logger.Info(c.Request().Context(), fmt.Sprintf("Handling component %s", splitString[0]), zap.String("component", body.MessageComponentData().CustomID))
-				comp.Execute(c, body)
+		customId := body.MessageComponentData().CustomID
+		if !customid.IsEncoded(customId) {
+			name = customId
+
+			// Messages posted before custom IDs were signed carry their state
+			// after an underscore, such as whitelabel::actions_<botId>
+			if _, ok := h.Components[name]; !ok {
+				if legacy, _, found := strings.Cut(customId, "_"); found {
+					if _, ok := h.Components[legacy]; ok {
+						logger.Warn(c.Request().Context(), "Rejected component with a legacy custom id", zap.String("component", customId))
+						responder.Error("This is no longer valid, please run the command again")
+						return nil
+					}
+				}
 			}
 		} else {
-			logger.Info(c.Request().Context(), fmt.Sprintf("Handling component %s", body.MessageComponentData().CustomID), zap.String("component", body.MessageComponentData().CustomID))
-			component.Execute(c, body)
+			name = customid.Prefix(customId)
+
+			prefix, values, err := h.CustomIds.Decode(customId)
+			if err != nil {
+				logger.Warn(c.Request().Context(), "Rejected component with an invalid custom id", zap.String("component", customId), zap.Error(err))
+				responder.Error("This is no longer valid, please run the command again")
+				return nil
+			}
+
+			c.SetRequest(c.Request().WithContext(customid.WithState(c.Request().Context(), customid.State{Prefix: prefix, Values: values})))
+		}
+
+		component, ok := h.Components[name]
+		if !ok {
+			return c.NoContent(404)
 		}
-		break
+
+		return h.execute(c, responder, body, botId, interactionType, name, component, func() {
+			logger.Info(c.Request().Context(), fmt.Sprintf("Handling component %s", name), zap.String("component", customId))
+			component.Execute(c.Request().Context(), responder, body)
+		})
 	}
 
 	return c.NoContent(404)
 }
 
+// execute runs an interaction once. A redelivered interaction is answered with
+// the response recorded the first time instead of running it again.
+func (h InteractionHandler) execute(c echo.Context, r discord.Responder, body discordgo.Interaction, botId string, interactionType string, name string, handler any, run func()) error {
+	run = h.limit(c.Request().Context(), r, body, interactionType, name, handler, run)
+
+	if h.Idempotency == nil {
+		run()
+		return nil
+	}
+
+	var (
+		ctx     = c.Request().Context()
+		durable = false
+	)
+
+	if m, ok := handler.(discord.Mutating); ok {
+		durable = m.Mutates(body)
+	}
+
+	previous, err := h.Idempotency.Claim(ctx, body.ID, botId, durable)
+	if err != nil {
+		if errors.Is(err, idempotency.ErrInProgress) {
+			metrics.DuplicateInteractions.WithLabelValues(interactionType).Inc()
+			r.Error("This is already being processed, please wait")
+			return nil
+		}
+		logger.Error(ctx, "Error claiming interaction", zap.Error(err), zap.String("interactionId", body.ID))
+		r.Error("Something went wrong, please try again")
+		return nil
+	}
+
+	if previous != nil {
+		metrics.DuplicateInteractions.WithLabelValues(interactionType).Inc()
+		logger.Info(ctx, "Replaying response to duplicate interaction", zap.String("interactionId", body.ID))
+		return previous.Write(c)
+	}
+
+	var (
+		result    = idempotency.Record(c)
+		completed = false
+	)
+
+	// A panicking handler has not sent anything worth replaying
+	defer func() {
+		if !completed {
+			if err := h.Idempotency.Release(ctx, body.ID, durable); err != nil {
+				logger.Error(ctx, "Error releasing interaction", zap.Error(err), zap.String("interactionId", body.ID))
+			}
+		}
+	}()
+
+	run()
+	completed = true
+
+	if err := h.Idempotency.Complete(ctx, body.ID, durable, result()); err != nil {
+		logger.Error(ctx, "Error recording interaction response", zap.Error(err), zap.String("interactionId", body.ID))
+	}
+
+	return nil
+}
+
+// limit wraps run so a limited handler used again before its cooldown has
+// passed is answered with how long is left instead. Cooldowns are checked as
+// part of running the interaction so that a redelivery is answered with the
+// original response rather than being turned away.
+func (h InteractionHandler) limit(ctx context.Context, r discord.Responder, body discordgo.Interaction, interactionType string, name string, handler any, run func()) func() {
+	limited, ok := handler.(discord.Limited)
+	if h.Cooldowns == nil || !ok {
+		return run
+	}
+
+	return func() {
+		cooldown := limited.Cooldown()
+
+		remaining, err := h.Cooldowns.Use(ctx, name, cooldown, body)
+		if err != nil {
+			// Not worth failing the interaction over
+			logger.Error(ctx, "Error checking cooldown", zap.Error(err), zap.String("name", name))
+		}
+
+		if remaining > 0 {
+			metrics.CooldownRejections.WithLabelValues(interactionType, name, string(cooldown.Scope)).Inc()
+			r.Error(fmt.Sprintf("This is on cooldown, try again in %ds", int(math.Ceil(remaining.Seconds()))))
+			return
+		}
+
+		run()
+	}
+}
+
+// recoverInteraction logs a panic raised while handling an interaction and, if
+// nothing has been sent yet, tells the user something went wrong along with a
+// reference that can be found in the logs.
+func recoverInteraction(ctx context.Context, r *discord.HTTPResponder, body discordgo.Interaction, interactionType string, name string, recovered any, span tracing.Span) {
+	correlationId := newCorrelationId()
+
+	metrics.InteractionPanics.WithLabelValues(interactionType, name).Inc()
+	span.SetTag("correlation_id", correlationId)
+	span.SetError(fmt.Errorf("panic: %v", recovered))
+
+	logger.Error(ctx, "Recovered from panic while handling interaction",
+		zap.Any("panic", recovered),
+		zap.String("correlationId", correlationId),
+		zap.String("interactionId", body.ID),
+		zap.String("interactionType", interactionType),
+		zap.String("name", name),
+		zap.String("guildId", body.GuildID),
+		zap.String("channelId", body.ChannelID),
+	)
+
+	if r.Responded() {
+		return
+	}
+
+	r.Error(fmt.Sprintf("Something went wrong while handling this, please try again later.\nIf this keeps happening, share this reference with support: `%s`", correlationId))
+}
+
+func newCorrelationId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
 func addContextInfo(c echo.Context, body discordgo.Interaction, botId string) echo.Context {
 	ctx := c.Request().Context()
-	ctx = context.WithValue(ctx, utils.UserIdContextKey, body.Member.User.ID)
+	ctx = context.WithValue(ctx, utils.UserIdContextKey, discord.InvokingUserId(body))
 	ctx = context.WithValue(ctx, utils.GuildIdContextKey, body.GuildID)
 	ctx = context.WithValue(ctx, utils.ChannelIdContextKey, body.ChannelID)
 	ctx = context.WithValue(ctx, utils.BotIdContextKey, botId)
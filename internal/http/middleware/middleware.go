@@ -2,58 +2,57 @@ package middleware
 
 import (
 	"crypto/ed25519"
-	"encoding/hex"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/prosperitybot/common/logger"
-	"github.com/prosperitybot/common/utils"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/metrics"
 	"go.uber.org/zap"
 )
 
 type MiddlewareHandler struct {
-	db *sqlx.DB
+	mainBotId     string
+	mainPublicKey ed25519.PublicKey
+	publicKeys    *cache.PublicKeyCache
+	maxSkew       time.Duration
 }
 
 func (h MiddlewareHandler) InteractionAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var (
-			botId     = c.Param("bot_id")
-			botExists = botId == utils.GetMainBotId()
-			isMainBot = botId == utils.GetMainBotId()
-			publicKey string
+			botId  = c.Param("bot_id")
+			pubKey ed25519.PublicKey
 		)
 
-		if !botExists {
-			if err := h.db.GetContext(c.Request().Context(), &botExists, "SELECT exists (SELECT 1 FROM whitelabel_bots WHERE botId = ?)", botId); err != nil {
-				logger.Error(c.Request().Context(), "Error checking if bot exists", zap.Error(err))
-				return c.NoContent(500)
-			}
-			if err := h.db.GetContext(c.Request().Context(), &publicKey, "SELECT publicKey FROM whitelabel_bots WHERE botId = ?", botId); err != nil {
+		if botId == h.mainBotId {
+			pubKey = h.mainPublicKey
+		} else {
+			key, botExists, err := h.publicKeys.Get(c.Request().Context(), botId)
+			if err != nil {
 				logger.Error(c.Request().Context(), "Error getting public key", zap.Error(err))
 				return c.NoContent(500)
 			}
-		}
-
-		if !botExists {
-			return c.NoContent(404)
-		}
 
-		if isMainBot {
-			publicKey = os.Getenv("DISCORD_PUBLIC_KEY")
+			if !botExists {
+				return c.NoContent(404)
+			}
+			pubKey = key
 		}
 
-		pubKeyBytes, err := hex.DecodeString(publicKey)
-		if err != nil {
-			logger.Error(c.Request().Context(), "Error decoding public key", zap.Error(err))
-			c.Error(err)
+		if !discordgo.VerifyInteraction(c.Request(), pubKey) {
+			metrics.SignatureFailures.WithLabelValues(botId).Inc()
+			c.NoContent(401)
+			return nil
 		}
 
-		pubKey := ed25519.PublicKey(pubKeyBytes)
-
-		if !discordgo.VerifyInteraction(c.Request(), pubKey) {
+		// The timestamp is part of the signed message, so it can only be
+		// trusted once the signature has been verified
+		if reason := h.checkTimestamp(c.Request().Header.Get("X-Signature-Timestamp")); reason != "" {
+			metrics.ReplayRejections.WithLabelValues(botId, reason).Inc()
+			logger.Warn(c.Request().Context(), "Rejected interaction outside of the replay window", zap.String("reason", reason), zap.String("botId", botId))
 			c.NoContent(401)
 			return nil
 		}
@@ -67,8 +66,34 @@ func (h MiddlewareHandler) InteractionAuthMiddleware(next echo.HandlerFunc) echo
 	}
 }
 
-func NewMiddlewareHandler(db *sqlx.DB) MiddlewareHandler {
+// checkTimestamp returns why the signature timestamp falls outside of the
+// allowed skew, or "" if it is acceptable.
+func (h MiddlewareHandler) checkTimestamp(header string) string {
+	if h.maxSkew == 0 {
+		return ""
+	}
+
+	seconds, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return "invalid"
+	}
+
+	skew := time.Since(time.Unix(seconds, 0))
+	switch {
+	case skew > h.maxSkew:
+		return "stale"
+	case skew < -h.maxSkew:
+		return "future"
+	}
+
+	return ""
+}
+
+func NewMiddlewareHandler(mainBotId string, mainPublicKey ed25519.PublicKey, publicKeys *cache.PublicKeyCache, maxSkew time.Duration) MiddlewareHandler {
 	return MiddlewareHandler{
-		db: db,
+		mainBotId:     mainBotId,
+		mainPublicKey: mainPublicKey,
+		publicKeys:    publicKeys,
+		maxSkew:       maxSkew,
 	}
 }
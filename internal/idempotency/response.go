@@ -0,0 +1,56 @@
+package idempotency
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Response is what was sent back to Discord for an interaction.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Write sends the response again, for a redelivered interaction.
+func (r Response) Write(c echo.Context) error {
+	if len(r.Body) == 0 {
+		return c.NoContent(r.Status)
+	}
+	return c.Blob(r.Status, r.ContentType, r.Body)
+}
+
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush is needed for deferred responses, echo panics when flushing a writer
+// that can't.
+func (r *recorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Record captures everything written to c's response from now on. The
+// returned function builds the Response once the handler has finished.
+func Record(c echo.Context) func() Response {
+	rec := &recorder{ResponseWriter: c.Response().Writer}
+	c.Response().Writer = rec
+
+	return func() Response {
+		return Response{
+			Status:      c.Response().Status,
+			ContentType: c.Response().Header().Get(echo.HeaderContentType),
+			Body:        rec.body.Bytes(),
+		}
+	}
+}
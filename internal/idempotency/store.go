@@ -0,0 +1,260 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/common/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultSize          = 10000
+	DefaultWait          = 3 * time.Second
+	DefaultRetention     = 24 * time.Hour
+	DefaultPruneInterval = time.Hour
+
+	errDuplicateEntry = 1062
+	pollInterval      = 100 * time.Millisecond
+)
+
+// ErrInProgress is returned by Claim when the interaction is still being
+// handled elsewhere and did not finish within the wait time.
+var ErrInProgress = errors.New("interaction is already being processed")
+
+type entry struct {
+	id       string
+	done     chan struct{}
+	response Response
+	failed   bool
+}
+
+// Store remembers the response sent for every interaction the worker has
+// handled. All interactions are kept in a bounded in-memory LRU, which covers
+// redeliveries to the same replica. Interactions that change data are also
+// recorded in the processed_interactions table so that a redelivery to
+// another replica cannot apply the change twice.
+type Store struct {
+	db   *sqlx.DB
+	size int
+	wait time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// Claim marks the interaction as being handled. It returns nil if the caller
+// should handle it, or the original response if it has been handled before.
+// If durable is set, the claim is also recorded in the database.
+func (s *Store) Claim(ctx context.Context, interactionId string, botId string, durable bool) (*Response, error) {
+	if existing, claimed := s.claimMemory(interactionId); !claimed {
+		return s.waitMemory(ctx, existing)
+	}
+
+	if !durable {
+		return nil, nil
+	}
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO processed_interactions (interactionId, botId, createdAt) VALUES (?, ?, ?)", interactionId, botId, time.Now().UTC())
+	if err == nil {
+		return nil, nil
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != errDuplicateEntry {
+		s.forget(interactionId)
+		return nil, err
+	}
+
+	response, err := s.waitDatabase(ctx, interactionId)
+	if err != nil {
+		s.forget(interactionId)
+		return nil, err
+	}
+
+	s.complete(interactionId, *response)
+	return response, nil
+}
+
+// Complete stores the response for an interaction claimed with Claim and
+// releases anyone waiting on it.
+func (s *Store) Complete(ctx context.Context, interactionId string, durable bool, response Response) error {
+	s.complete(interactionId, response)
+
+	if !durable {
+		return nil
+	}
+
+	_, err := s.db.ExecContext(ctx, "UPDATE processed_interactions SET status = ?, contentType = ?, body = ?, completedAt = ? WHERE interactionId = ?",
+		response.Status, response.ContentType, response.Body, time.Now().UTC(), interactionId)
+	return err
+}
+
+// Release gives up a claim without recording a response, for handlers that
+// did not finish. A redelivery of the interaction is then handled again.
+func (s *Store) Release(ctx context.Context, interactionId string, durable bool) error {
+	s.forget(interactionId)
+
+	if !durable {
+		return nil
+	}
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM processed_interactions WHERE interactionId = ? AND status IS NULL", interactionId)
+	return err
+}
+
+// Prune removes database records older than retention.
+func (s *Store) Prune(ctx context.Context, retention time.Duration) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM processed_interactions WHERE createdAt < ?", time.Now().UTC().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Run prunes the database records every interval until ctx is cancelled.
+func (s *Store) Run(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if pruned, err := s.Prune(ctx, retention); err != nil {
+			logger.Error(ctx, "Error pruning processed interactions", zap.Error(err))
+		} else if pruned > 0 {
+			logger.Debug(ctx, "Pruned processed interactions", zap.Int64("count", pruned))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+func (s *Store) claimMemory(interactionId string) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[interactionId]; ok {
+		s.order.MoveToFront(element)
+		return element.Value.(*entry), false
+	}
+
+	s.entries[interactionId] = s.order.PushFront(&entry{id: interactionId, done: make(chan struct{})})
+
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*entry).id)
+	}
+
+	return nil, true
+}
+
+func (s *Store) waitMemory(ctx context.Context, e *entry) (*Response, error) {
+	timer := time.NewTimer(s.wait)
+	defer timer.Stop()
+
+	select {
+	case <-e.done:
+		if e.failed {
+			return nil, ErrInProgress
+		}
+		response := e.response
+		return &response, nil
+	case <-timer.C:
+		return nil, ErrInProgress
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Store) waitDatabase(ctx context.Context, interactionId string) (*Response, error) {
+	deadline := time.Now().Add(s.wait)
+
+	for {
+		var row struct {
+			Status      sql.NullInt64  `db:"status"`
+			ContentType sql.NullString `db:"contentType"`
+			Body        []byte         `db:"body"`
+		}
+
+		if err := s.db.GetContext(ctx, &row, "SELECT status, contentType, body FROM processed_interactions WHERE interactionId = ?", interactionId); err != nil {
+			return nil, err
+		}
+
+		if row.Status.Valid {
+			return &Response{Status: int(row.Status.Int64), ContentType: row.ContentType.String, Body: row.Body}, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrInProgress
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Store) complete(interactionId string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[interactionId]
+	if !ok {
+		// Evicted while in flight, anyone still waiting on it will time out
+		return
+	}
+
+	e := element.Value.(*entry)
+	select {
+	case <-e.done:
+	default:
+		e.response = response
+		close(e.done)
+	}
+}
+
+// forget drops an in-flight claim that could not be recorded, so a retry is
+// handled normally.
+func (s *Store) forget(interactionId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[interactionId]; ok {
+		s.order.Remove(element)
+		delete(s.entries, interactionId)
+
+		e := element.Value.(*entry)
+		e.failed = true
+		close(e.done)
+	}
+}
+
+func NewStore(db *sqlx.DB, size int, wait time.Duration) *Store {
+	return &Store{
+		db:      db,
+		size:    size,
+		wait:    wait,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
@@ -0,0 +1,176 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/idempotency"
+)
+
+const (
+	interactionId = "800000000000000008"
+	botId         = "700000000000000007"
+)
+
+var response = idempotency.Response{Status: http.StatusOK, ContentType: "application/json", Body: []byte(`{"type":4}`)}
+
+func newStore(t *testing.T, wait time.Duration) (*idempotency.Store, sqlmock.Sqlmock) {
+	t.Helper()
+
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("database expectations: %s", err)
+		}
+		mockDb.Close()
+	})
+
+	return idempotency.NewStore(sqlx.NewDb(mockDb, "mysql"), idempotency.DefaultSize, wait), mock
+}
+
+func expectInsert(mock sqlmock.Sqlmock, err error) {
+	expectation := mock.ExpectExec(regexp.QuoteMeta("INSERT INTO processed_interactions (interactionId, botId, createdAt) VALUES (?, ?, ?)")).
+		WithArgs(interactionId, botId, sqlmock.AnyArg())
+	if err != nil {
+		expectation.WillReturnError(err)
+		return
+	}
+	expectation.WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectRecorded(mock sqlmock.Sqlmock, status interface{}) {
+	rows := sqlmock.NewRows([]string{"status", "contentType", "body"})
+	if status == nil {
+		rows.AddRow(nil, nil, nil)
+	} else {
+		rows.AddRow(status, response.ContentType, response.Body)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status, contentType, body FROM processed_interactions WHERE interactionId = ?")).
+		WithArgs(interactionId).
+		WillReturnRows(rows)
+}
+
+func TestDuplicateInMemory(t *testing.T) {
+	var (
+		s, _ = newStore(t, time.Second)
+		ctx  = context.Background()
+	)
+
+	if previous, err := s.Claim(ctx, interactionId, botId, false); err != nil || previous != nil {
+		t.Fatalf("expected the first claim to succeed, got %v and %v", previous, err)
+	}
+
+	// A redelivery while the first is still being handled waits for it
+	replayed := make(chan *idempotency.Response, 1)
+	go func() {
+		previous, err := s.Claim(ctx, interactionId, botId, false)
+		if err != nil {
+			t.Errorf("claiming the duplicate: %s", err)
+		}
+		replayed <- previous
+	}()
+
+	if err := s.Complete(ctx, interactionId, false, response); err != nil {
+		t.Fatalf("completing: %s", err)
+	}
+
+	if previous := <-replayed; previous == nil || string(previous.Body) != string(response.Body) {
+		t.Errorf("expected the duplicate to get the original response, got %+v", previous)
+	}
+}
+
+func TestDuplicateInDatabase(t *testing.T) {
+	s, mock := newStore(t, time.Second)
+
+	// Handled by another worker
+	expectInsert(mock, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	expectRecorded(mock, http.StatusOK)
+
+	previous, err := s.Claim(context.Background(), interactionId, botId, true)
+	if err != nil {
+		t.Fatalf("claiming: %s", err)
+	}
+	if previous == nil || previous.Status != http.StatusOK || string(previous.Body) != string(response.Body) {
+		t.Errorf("expected the recorded response, got %+v", previous)
+	}
+
+	// The response is now remembered in memory too
+	if previous, err := s.Claim(context.Background(), interactionId, botId, true); err != nil || previous == nil {
+		t.Errorf("expected the response to be replayed from memory, got %v and %v", previous, err)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	t.Run("in memory", func(t *testing.T) {
+		s, _ := newStore(t, 10*time.Millisecond)
+
+		if _, err := s.Claim(context.Background(), interactionId, botId, false); err != nil {
+			t.Fatalf("claiming: %s", err)
+		}
+		if _, err := s.Claim(context.Background(), interactionId, botId, false); !errors.Is(err, idempotency.ErrInProgress) {
+			t.Errorf("expected the duplicate to give up waiting, got %v", err)
+		}
+	})
+
+	t.Run("in the database", func(t *testing.T) {
+		s, mock := newStore(t, 50*time.Millisecond)
+
+		expectInsert(mock, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+		expectRecorded(mock, nil)
+		expectRecorded(mock, nil)
+
+		if _, err := s.Claim(context.Background(), interactionId, botId, true); !errors.Is(err, idempotency.ErrInProgress) {
+			t.Errorf("expected the duplicate to give up waiting, got %v", err)
+		}
+
+		// Giving up doesn't leave a claim behind
+		expectInsert(mock, nil)
+		if previous, err := s.Claim(context.Background(), interactionId, botId, true); err != nil || previous != nil {
+			t.Errorf("expected a later delivery to be handled, got %v and %v", previous, err)
+		}
+	})
+}
+
+func TestReleaseAfterPanic(t *testing.T) {
+	var (
+		s, mock = newStore(t, time.Second)
+		ctx     = context.Background()
+	)
+
+	expectInsert(mock, nil)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM processed_interactions WHERE interactionId = ? AND status IS NULL")).
+		WithArgs(interactionId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectInsert(mock, nil)
+
+	if _, err := s.Claim(ctx, interactionId, botId, true); err != nil {
+		t.Fatalf("claiming: %s", err)
+	}
+
+	// The same as the interaction handler, which releases the claim when the
+	// command panics
+	func() {
+		defer func() {
+			recover()
+			if err := s.Release(ctx, interactionId, true); err != nil {
+				t.Errorf("releasing: %s", err)
+			}
+		}()
+		panic("command failed")
+	}()
+
+	if previous, err := s.Claim(ctx, interactionId, botId, true); err != nil || previous != nil {
+		t.Errorf("expected a redelivery to be handled again, got %v and %v", previous, err)
+	}
+}
@@ -0,0 +1,126 @@
+package interactiontest
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+type Option = discordgo.ApplicationCommandInteractionDataOption
+
+// Command builds a slash command interaction sent by UserId in GuildId.
+func (h *Harness) Command(name string, options ...*Option) discordgo.Interaction {
+	return h.inGuild(discordgo.Interaction{
+		Type: discordgo.InteractionApplicationCommand,
+		Data: discordgo.ApplicationCommandInteractionData{
+			ID:      h.nextId(),
+			Name:    name,
+			Options: options,
+		},
+	})
+}
+
+// Component builds a message component interaction sent by UserId in
+// GuildId. Values are the selected options of a select menu.
+func (h *Harness) Component(customId string, values ...string) discordgo.Interaction {
+	componentType := discordgo.ButtonComponent
+	if len(values) > 0 {
+		componentType = discordgo.SelectMenuComponent
+	}
+
+	return h.inGuild(discordgo.Interaction{
+		Type: discordgo.InteractionMessageComponent,
+		Data: discordgo.MessageComponentInteractionData{
+			CustomID:      customId,
+			ComponentType: componentType,
+			Values:        values,
+		},
+	})
+}
+
+// InDM moves an interaction to a direct message with UserId.
+func InDM(i discordgo.Interaction) discordgo.Interaction {
+	i.GuildID = ""
+	i.Member = nil
+	i.User = &discordgo.User{ID: UserId, Username: "tester"}
+	return i
+}
+
+// SentBy changes who sent an interaction.
+func SentBy(i discordgo.Interaction, userId string) discordgo.Interaction {
+	user := &discordgo.User{ID: userId, Username: "tester-" + userId}
+	if i.Member != nil {
+		member := *i.Member
+		member.User = user
+		i.Member = &member
+	} else {
+		i.User = user
+	}
+	return i
+}
+
+func (h *Harness) inGuild(i discordgo.Interaction) discordgo.Interaction {
+	i.ID = h.nextId()
+	i.AppID = BotId
+	i.Token = "interaction-token-" + i.ID
+	i.Version = 1
+	i.GuildID = GuildId
+	i.ChannelID = ChannelId
+	i.Member = &discordgo.Member{
+		GuildID: GuildId,
+		User:    &discordgo.User{ID: UserId, Username: "tester"},
+	}
+	return i
+}
+
+func SubCommand(name string, options ...*Option) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionSubCommand, Options: options}
+}
+
+func SubCommandGroup(name string, subCommands ...*Option) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionSubCommandGroup, Options: subCommands}
+}
+
+func String(name string, value string) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionString, Value: value}
+}
+
+// Integer options arrive from Discord as JSON numbers, which decode to float64.
+func Integer(name string, value int64) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionInteger, Value: float64(value)}
+}
+
+func Number(name string, value float64) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionNumber, Value: value}
+}
+
+func User(name string, id string) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionUser, Value: id}
+}
+
+func Channel(name string, id string) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionChannel, Value: id}
+}
+
+func Role(name string, id string) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionRole, Value: id}
+}
+
+// Description returns the description of the response's first embed.
+func Description(response discordgo.InteractionResponse) string {
+	if response.Data == nil || len(response.Data.Embeds) == 0 {
+		return ""
+	}
+	return response.Data.Embeds[0].Description
+}
+
+// EditDescription is Description for an edit of the original response.
+func EditDescription(edit discordgo.WebhookEdit) string {
+	if edit.Embeds == nil || len(*edit.Embeds) == 0 {
+		return ""
+	}
+	return (*edit.Embeds)[0].Description
+}
+
+// Ephemeral reports whether only the invoking user can see the response.
+func Ephemeral(response discordgo.InteractionResponse) bool {
+	return response.Data != nil && response.Data.Flags&discordgo.MessageFlagsEphemeral != 0
+}
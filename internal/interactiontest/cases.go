@@ -0,0 +1,56 @@
+package interactiontest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/worker/internal/discord/rest/resttest"
+)
+
+// Case is one interaction sent through a fresh harness, along with the
+// database calls it is expected to make and the response it should get.
+type Case struct {
+	Name        string
+	Interaction func(h *Harness) discordgo.Interaction
+	Expect      func(mock sqlmock.Sqlmock)
+	// Discord sets up the replies of the stand-in Discord API.
+	Discord func(server *resttest.Server)
+	// Want must appear in the description of the response's first embed.
+	Want      string
+	Ephemeral bool
+	// Check makes any further assertions on the response, once the jobs the
+	// interaction started in the background have finished.
+	Check func(t *testing.T, h *Harness, response discordgo.InteractionResponse)
+}
+
+func RunCases(t *testing.T, setup Setup, cases []Case) {
+	t.Helper()
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			h := New(t, setup)
+			if tc.Expect != nil {
+				tc.Expect(h.Mock)
+			}
+			if tc.Discord != nil {
+				tc.Discord(h.Discord)
+			}
+
+			response := h.Respond(tc.Interaction(h))
+			h.Wait()
+
+			if description := Description(response); !strings.Contains(description, tc.Want) {
+				t.Errorf("expected response containing %q, got %q", tc.Want, description)
+			}
+			if Ephemeral(response) != tc.Ephemeral {
+				t.Errorf("expected ephemeral to be %t", tc.Ephemeral)
+			}
+			if tc.Check != nil {
+				tc.Check(t, h, response)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Package interactiontest sends signed interactions through the worker's
+// HTTP stack, the same way Discord does, for use in tests.
+package interactiontest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bwmarrin/discordgo"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/worker/internal/background"
+	"github.com/prosperitybot/worker/internal/cache"
+	"github.com/prosperitybot/worker/internal/cooldown"
+	"github.com/prosperitybot/worker/internal/database"
+	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/discord/customid"
+	"github.com/prosperitybot/worker/internal/discord/rest"
+	"github.com/prosperitybot/worker/internal/discord/rest/resttest"
+	"github.com/prosperitybot/worker/internal/http/handler"
+	"github.com/prosperitybot/worker/internal/http/middleware"
+	"github.com/prosperitybot/worker/internal/store"
+	"github.com/prosperitybot/worker/internal/tracing"
+)
+
+const (
+	BotId     = "100000000000000001"
+	GuildId   = "200000000000000002"
+	ChannelId = "300000000000000003"
+	UserId    = "400000000000000004"
+
+	MaxTimestampSkew = 30 * time.Second
+	JobTimeout       = 5 * time.Second
+)
+
+type Harness struct {
+	T    testing.TB
+	Echo *echo.Echo
+	DB   *sqlx.DB
+	Mock sqlmock.Sqlmock
+	// CustomIds is the codec the handler verifies component custom IDs with.
+	CustomIds customid.Codec
+	// Discord stands in for the Discord REST API.
+	Discord *resttest.Server
+	// Jobs runs the work interactions start in the background, see Wait.
+	Jobs *background.Runner
+	// Cooldowns is only enforced by the handler when created WithCooldowns.
+	Cooldowns *cooldown.Limiter
+
+	privateKey ed25519.PrivateKey
+	sequence   int
+}
+
+// Env is what the interactions served by a harness are built from.
+type Env struct {
+	DB        *sqlx.DB
+	CustomIds customid.Codec
+	// Discord calls the harness's stand-in for Discord without a token.
+	Discord   rest.Client
+	Jobs      *background.Runner
+	Cooldowns *cooldown.Limiter
+	// Store is not shared, so it never writes to cache_versions.
+	Store *store.Store
+}
+
+// Setup builds the interactions to serve.
+type Setup func(env Env) (map[string]discord.SlashCommand, map[string]discord.Component)
+
+type harnessOptions struct {
+	cooldowns bool
+}
+
+type HarnessOption func(o *harnessOptions)
+
+// WithCooldowns has the handler enforce cooldowns. They are off by default so
+// tests can send the same command repeatedly.
+func WithCooldowns() HarnessOption {
+	return func(o *harnessOptions) {
+		o.cooldowns = true
+	}
+}
+
+// New starts a harness whose bot is BotId, with a freshly generated signing
+// key and a mocked database. Unmet database expectations fail the test.
+func New(t testing.TB, setup Setup, opts ...HarnessOption) *Harness {
+	t.Helper()
+
+	var o harnessOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	db := sqlx.NewDb(mockDb, "mysql")
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("database expectations: %s", err)
+		}
+		db.Close()
+	})
+
+	var (
+		discordServer        = resttest.NewServer(t)
+		jobs                 = background.NewRunner()
+		cooldowns            = cooldown.NewLimiter(db, cooldown.DefaultOverrideTTL)
+		customIds            = customid.NewCodec([]byte("interactiontest"))
+		commands, components = setup(Env{DB: db, CustomIds: customIds, Discord: discordServer.Client(""), Jobs: jobs, Cooldowns: cooldowns, Store: store.NewStore(database.NewDB(db, nil), store.DefaultTTL, 0, false)})
+		publicKeys           = cache.NewPublicKeyCache(db, cache.DefaultPublicKeySize, cache.DefaultPublicKeyTTL, cache.DefaultPublicKeyNegativeTTL, false)
+		middlewareHandler    = middleware.NewMiddlewareHandler(BotId, publicKey, publicKeys, MaxTimestampSkew)
+		interactionHandler   = handler.InteractionHandler{
+			Commands:   commands,
+			Components: components,
+			Tracer:     tracing.Noop(),
+			CustomIds:  customIds,
+			Discord:    discordServer.Client(""),
+		}
+	)
+
+	if o.cooldowns {
+		interactionHandler.Cooldowns = cooldowns
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	authGroup := e.Group("")
+	authGroup.Use(middlewareHandler.InteractionAuthMiddleware)
+	authGroup.POST("/interactions/:bot_id", interactionHandler.POSTInteractions)
+
+	return &Harness{
+		T:          t,
+		Echo:       e,
+		DB:         db,
+		Mock:       mock,
+		CustomIds:  customIds,
+		Discord:    discordServer,
+		Jobs:       jobs,
+		Cooldowns:  cooldowns,
+		privateKey: privateKey,
+	}
+}
+
+// Send signs the interaction and posts it to the worker as BotId.
+func (h *Harness) Send(interaction discordgo.Interaction) *httptest.ResponseRecorder {
+	h.T.Helper()
+
+	body, err := json.Marshal(interaction)
+	if err != nil {
+		h.T.Fatalf("encoding interaction: %s", err)
+	}
+
+	return h.SendRaw(BotId, body, time.Now(), h.privateKey)
+}
+
+// SendRaw posts body to botId's endpoint signed with key at timestamp. A nil
+// key sends the request with an invalid signature.
+func (h *Harness) SendRaw(botId string, body []byte, timestamp time.Time, key ed25519.PrivateKey) *httptest.ResponseRecorder {
+	h.T.Helper()
+
+	var (
+		ts        = strconv.FormatInt(timestamp.Unix(), 10)
+		signature = make([]byte, ed25519.SignatureSize)
+	)
+
+	if key != nil {
+		signature = ed25519.Sign(key, append([]byte(ts), body...))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/interactions/"+botId, bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-Signature-Timestamp", ts)
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+
+	rec := httptest.NewRecorder()
+	h.Echo.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// Wait waits for the background jobs started so far, failing the test if
+// they take longer than JobTimeout.
+func (h *Harness) Wait() {
+	h.T.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), JobTimeout)
+	defer cancel()
+
+	if err := h.Jobs.Wait(ctx); err != nil {
+		h.T.Fatalf("waiting for background jobs: %s", err)
+	}
+}
+
+// Edits returns the edits made to the original responses of interactions,
+// such as those completing a deferred response.
+func (h *Harness) Edits() []discordgo.WebhookEdit {
+	h.T.Helper()
+
+	var edits []discordgo.WebhookEdit
+	for _, call := range h.Discord.Calls() {
+		if call.Method != http.MethodPatch || !strings.HasPrefix(call.Path, "webhooks/"+BotId+"/") || !strings.HasSuffix(call.Path, "/messages/@original") {
+			continue
+		}
+
+		var edit discordgo.WebhookEdit
+		if err := call.Decode(&edit); err != nil {
+			h.T.Fatalf("decoding edit %s: %s", call.Body, err)
+		}
+		edits = append(edits, edit)
+	}
+
+	return edits
+}
+
+// PrivateKey is the key interactions to BotId are signed with.
+func (h *Harness) PrivateKey() ed25519.PrivateKey {
+	return h.privateKey
+}
+
+// Respond sends the interaction and decodes the worker's response, failing
+// the test unless it was a 200.
+func (h *Harness) Respond(interaction discordgo.Interaction) discordgo.InteractionResponse {
+	h.T.Helper()
+
+	rec := h.Send(interaction)
+	if rec.Code != http.StatusOK {
+		h.T.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	response, err := decodeResponse(rec.Body.Bytes())
+	if err != nil {
+		h.T.Fatalf("decoding response %q: %s", rec.Body.String(), err)
+	}
+
+	return response
+}
+
+// decodeResponse decodes an interaction response, including the message
+// components discordgo can only encode.
+func decodeResponse(body []byte) (discordgo.InteractionResponse, error) {
+	var raw struct {
+		Type discordgo.InteractionResponseType `json:"type"`
+		Data *struct {
+			discordgo.InteractionResponseData
+			Components []json.RawMessage `json:"components"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return discordgo.InteractionResponse{}, err
+	}
+
+	response := discordgo.InteractionResponse{Type: raw.Type}
+	if raw.Data == nil {
+		return response, nil
+	}
+
+	response.Data = &raw.Data.InteractionResponseData
+	for _, b := range raw.Data.Components {
+		component, err := discordgo.MessageComponentFromJSON(b)
+		if err != nil {
+			return response, err
+		}
+		response.Data.Components = append(response.Data.Components, component)
+	}
+
+	return response, nil
+}
+
+func (h *Harness) nextId() string {
+	h.sequence++
+	return strconv.Itoa(900000000000000000 + h.sequence)
+}
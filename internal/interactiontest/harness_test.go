@@ -0,0 +1,109 @@
+package interactiontest_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bwmarrin/discordgo"
+	"github.com/prosperitybot/worker/internal/discord"
+	"github.com/prosperitybot/worker/internal/interactiontest"
+)
+
+type panicCommand struct{}
+
+func (panicCommand) Command() discordgo.ApplicationCommand {
+	return discordgo.ApplicationCommand{Name: "panic"}
+}
+
+func (panicCommand) Execute(ctx context.Context, r discord.Responder, i discordgo.Interaction) {
+	var options []string
+	_ = options[1]
+}
+
+func setup(env interactiontest.Env) (map[string]discord.SlashCommand, map[string]discord.Component) {
+	return map[string]discord.SlashCommand{"panic": panicCommand{}}, map[string]discord.Component{}
+}
+
+func TestPing(t *testing.T) {
+	h := interactiontest.New(t, setup)
+
+	response := h.Respond(discordgo.Interaction{ID: "1", Type: discordgo.InteractionPing})
+
+	if response.Type != discordgo.InteractionResponsePong {
+		t.Errorf("expected pong, got %d", response.Type)
+	}
+}
+
+func TestSignatureVerification(t *testing.T) {
+	body, _ := json.Marshal(discordgo.Interaction{ID: "1", Type: discordgo.InteractionPing})
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	tests := []struct {
+		name      string
+		timestamp time.Duration
+		key       func(h *interactiontest.Harness) ed25519.PrivateKey
+		want      int
+	}{
+		{"valid", 0, (*interactiontest.Harness).PrivateKey, http.StatusOK},
+		{"unsigned", 0, func(*interactiontest.Harness) ed25519.PrivateKey { return nil }, http.StatusUnauthorized},
+		{"wrong key", 0, func(*interactiontest.Harness) ed25519.PrivateKey { return otherKey }, http.StatusUnauthorized},
+		{"stale", -interactiontest.MaxTimestampSkew - time.Minute, (*interactiontest.Harness).PrivateKey, http.StatusUnauthorized},
+		{"future", interactiontest.MaxTimestampSkew + time.Minute, (*interactiontest.Harness).PrivateKey, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := interactiontest.New(t, setup)
+
+			rec := h.SendRaw(interactiontest.BotId, body, time.Now().Add(tt.timestamp), tt.key(h))
+
+			if rec.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestUnknownBot(t *testing.T) {
+	h := interactiontest.New(t, setup)
+	h.Mock.ExpectQuery(`SELECT publicKey FROM whitelabel_bots WHERE botId = \?`).
+		WithArgs("123").
+		WillReturnRows(sqlmock.NewRows([]string{"publicKey"}))
+
+	body, _ := json.Marshal(discordgo.Interaction{ID: "1", Type: discordgo.InteractionPing})
+	rec := h.SendRaw("123", body, time.Now(), h.PrivateKey())
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	h := interactiontest.New(t, setup)
+
+	rec := h.Send(h.Command("missing"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	h := interactiontest.New(t, setup)
+
+	response := h.Respond(h.Command("panic"))
+
+	if !strings.Contains(interactiontest.Description(response), "share this reference with support") {
+		t.Errorf("expected an error with a correlation id, got %q", interactiontest.Description(response))
+	}
+	if !interactiontest.Ephemeral(response) {
+		t.Error("expected the error to be ephemeral")
+	}
+}
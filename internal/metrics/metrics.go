@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prosperitybot/worker/internal/database"
+)
+
+const namespace = "worker"
+
+// InteractionDeadline is how long Discord waits for the initial response to an
+// interaction before showing the user that it failed.
+const InteractionDeadline = 3 * time.Second
+
+var (
+	Interactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "interactions_total",
+		Help:      "Interactions received, by type, command or component name and bot.",
+	}, []string{"type", "name", "bot"})
+
+	InteractionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "interaction_duration_seconds",
+		Help:      "Time taken to respond to an interaction.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 3, 5, 10},
+	}, []string{"type", "name", "bot"})
+
+	InteractionDeadlineExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "interaction_deadline_exceeded_total",
+		Help:      "Interactions that took longer than Discord's 3 second response deadline.",
+	}, []string{"type", "name", "bot"})
+
+	InteractionPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "interaction_panics_total",
+		Help:      "Interactions whose handler panicked.",
+	}, []string{"type", "name"})
+
+	DuplicateInteractions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicate_interactions_total",
+		Help:      "Redelivered interactions that were answered without running them again.",
+	}, []string{"type"})
+
+	SignatureFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signature_failures_total",
+		Help:      "Interactions rejected because their signature did not verify.",
+	}, []string{"bot"})
+
+	CooldownRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cooldown_rejections_total",
+		Help:      "Interactions turned away because their command or component was cooling down.",
+	}, []string{"type", "name", "scope"})
+
+	ReplayRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replay_rejections_total",
+		Help:      "Correctly signed interactions rejected because their timestamp was stale, in the future or invalid.",
+	}, []string{"bot", "reason"})
+
+	DatabaseQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database operations.",
+		Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"operation"})
+
+	DatabaseQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Database operations that returned an error.",
+	}, []string{"operation"})
+
+	DiscordRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_requests_total",
+		Help:      "Requests made to the Discord API, by route and status code (or error).",
+	}, []string{"route", "status"})
+
+	DiscordRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "discord_request_duration_seconds",
+		Help:      "Time taken by requests to the Discord API, not counting time spent waiting on rate limits.",
+		Buckets:   []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"route"})
+
+	DiscordRateLimitWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "discord_rate_limit_wait_seconds",
+		Help:      "Time requests to the Discord API were queued waiting for their rate limit bucket or the global limit.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"route"})
+
+	DiscordRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_rate_limited_total",
+		Help:      "429 responses from the Discord API, by route and scope (user, global or shared).",
+	}, []string{"route", "scope"})
+
+	DiscordRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_retries_total",
+		Help:      "Requests to the Discord API that were retried, by route and reason.",
+	}, []string{"route", "reason"})
+)
+
+func ObserveInteraction(interactionType string, name string, botId string, duration time.Duration) {
+	Interactions.WithLabelValues(interactionType, name, botId).Inc()
+	InteractionDuration.WithLabelValues(interactionType, name, botId).Observe(duration.Seconds())
+
+	if duration > InteractionDeadline {
+		InteractionDeadlineExceeded.WithLabelValues(interactionType, name, botId).Inc()
+	}
+}
+
+func DatabaseHook(ctx context.Context, event database.QueryEvent) {
+	DatabaseQueryDuration.WithLabelValues(event.Operation).Observe(event.Duration.Seconds())
+
+	if event.Err != nil {
+		DatabaseQueryErrors.WithLabelValues(event.Operation).Inc()
+	}
+}
+
+// RegisterDatabase exposes the connection pool statistics of db.
+func RegisterDatabase(db *sqlx.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db.DB, name))
+}
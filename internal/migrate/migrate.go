@@ -0,0 +1,314 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/common/logger"
+	"go.uber.org/zap"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	lockName       = "worker_schema_migrations"
+	lockTimeout    = 60
+	errNoSuchTable = 1146
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// Latest is the schema version this build expects the database to be at.
+func (m Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Version returns the highest applied migration, or 0 when none have been
+// applied yet.
+func (m Migrator) Version(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	if err := m.db.GetContext(ctx, &version, "SELECT MAX(version) FROM schema_migrations"); err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+// Up applies every migration newer than the current version.
+func (m Migrator) Up(ctx context.Context) ([]Migration, error) {
+	conn, release, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+
+	current, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		logger.Info(ctx, "Applying migration", zap.Int("version", migration.Version), zap.String("name", migration.Name))
+
+		if err := execStatements(ctx, conn, migration.Up); err != nil {
+			return applied, fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)", migration.Version, migration.Name, time.Now().UTC()); err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// ErrIrreversible is returned by Down when it would have to revert a
+// migration whose down file has no statements.
+var ErrIrreversible = errors.New("migration can't be reverted")
+
+// Down reverts the given number of migrations, newest first. Nothing is
+// reverted if any of them are irreversible.
+func (m Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	conn, release, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	current, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(pending) < steps; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current {
+			continue
+		}
+
+		if len(splitStatements(migration.Down)) == 0 {
+			return nil, fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+
+		pending = append(pending, migration)
+	}
+
+	var reverted []Migration
+	for _, migration := range pending {
+		logger.Info(ctx, "Reverting migration", zap.Int("version", migration.Version), zap.String("name", migration.Name))
+
+		if err := execStatements(ctx, conn, migration.Down); err != nil {
+			return reverted, fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+			return reverted, err
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+func (m Migrator) ensureVersionTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		appliedAt DATETIME NOT NULL,
+		PRIMARY KEY (version)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)
+	return err
+}
+
+// lock takes a MySQL named lock so that replicas starting at the same time
+// don't run the same migrations twice. The lock belongs to the connection, so
+// the migrations are run on that connection as well.
+func (m Migrator) lock(ctx context.Context) (*sqlx.Conn, func(), error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.GetContext(ctx, &acquired, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("timed out waiting for the %s lock", lockName)
+	}
+
+	release := func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName); err != nil {
+			logger.Error(ctx, "Error releasing migration lock", zap.Error(err))
+		}
+		conn.Close()
+	}
+
+	return conn, release, nil
+}
+
+func execStatements(ctx context.Context, conn *sqlx.Conn, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on semicolons that end a line. The driver
+// isn't opened with multiStatements, so each statement is sent on its own.
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+	)
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		var (
+			fileName  = entry.Name()
+			direction string
+		)
+
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionPart, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>", fileName)
+		}
+
+		version, err := strconv.Atoi(versionPart)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", fileName, err)
+		}
+
+		contents, err := fs.ReadFile(files, path.Join("migrations", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func NewMigrator(db *sqlx.DB) (Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return Migrator{}, err
+	}
+
+	return Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
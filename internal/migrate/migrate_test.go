@@ -0,0 +1,45 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/migrate"
+)
+
+func TestDownStopsAtInitial(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	defer mockDb.Close()
+
+	migrator, err := migrate.NewMigrator(sqlx.NewDb(mockDb, "mysql"))
+	if err != nil {
+		t.Fatalf("loading migrations: %s", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT MAX(version) FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT RELEASE_LOCK(?)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// 0002 could be reverted on its own, but not as part of going below 0001
+	reverted, err := migrator.Down(context.Background(), 2)
+	if !errors.Is(err, migrate.ErrIrreversible) {
+		t.Errorf("expected the initial migration to be irreversible, got %v", err)
+	}
+	if len(reverted) != 0 {
+		t.Errorf("expected nothing to be reverted, got %+v", reverted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("database expectations: %s", err)
+	}
+}
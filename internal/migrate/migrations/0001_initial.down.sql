@@ -0,0 +1,2 @@
+-- 0001 can't be reverted. It adopts the tables the bot already had, so
+-- dropping them would delete all of their data. Down migrations stop here.
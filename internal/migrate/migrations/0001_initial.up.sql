@@ -0,0 +1,91 @@
+-- Tables are created with IF NOT EXISTS so that environments which were set
+-- up before migrations existed can adopt them without being recreated.
+
+CREATE TABLE IF NOT EXISTS guilds (
+    id VARCHAR(32) NOT NULL,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    notificationType VARCHAR(16) NOT NULL DEFAULT 'reply',
+    notificationChannel VARCHAR(32) NULL,
+    xpDelay INT NOT NULL DEFAULT 60,
+    xpRate DOUBLE NOT NULL DEFAULT 1,
+    roleAssignType VARCHAR(16) NOT NULL DEFAULT 'stack',
+    locale VARCHAR(16) NOT NULL DEFAULT 'en',
+    serverLocaleOnly TINYINT(1) NOT NULL DEFAULT 0,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(32) NOT NULL,
+    username VARCHAR(100) NOT NULL,
+    discriminator VARCHAR(4) NOT NULL DEFAULT '0',
+    access_levels TEXT NULL,
+    premium_source VARCHAR(32) NULL,
+    locale VARCHAR(16) NULL,
+    is_admin TINYINT(1) NOT NULL DEFAULT 0,
+    is_support TINYINT(1) NOT NULL DEFAULT 0,
+    is_translator TINYINT(1) NOT NULL DEFAULT 0,
+    premium_status TINYINT(1) NOT NULL DEFAULT 0,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS guild_users (
+    guildId VARCHAR(32) NOT NULL,
+    userId VARCHAR(32) NOT NULL,
+    level INT NOT NULL DEFAULT 0,
+    xp BIGINT NOT NULL DEFAULT 0,
+    lastXpMessageSent DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    messageCount INT NOT NULL DEFAULT 0,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (guildId, userId),
+    KEY guild_users_guildId_xp (guildId, xp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS level_roles (
+    id VARCHAR(32) NOT NULL,
+    guildId VARCHAR(32) NOT NULL,
+    level INT NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY level_roles_guildId_level (guildId, level)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS ignored_channels (
+    id VARCHAR(32) NOT NULL,
+    guildId VARCHAR(32) NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (guildId, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS ignored_roles (
+    id VARCHAR(32) NOT NULL,
+    guildId VARCHAR(32) NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (guildId, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS whitelabel_bots (
+    botId VARCHAR(32) NOT NULL,
+    oldBotId VARCHAR(32) NULL,
+    userId VARCHAR(32) NULL,
+    token VARCHAR(255) NOT NULL,
+    publicKey VARCHAR(64) NULL,
+    action VARCHAR(16) NULL,
+    last_action VARCHAR(16) NOT NULL DEFAULT 'none',
+    botName VARCHAR(100) NULL,
+    botDiscrim VARCHAR(4) NULL,
+    botAvatarHash VARCHAR(64) NULL,
+    statusType VARCHAR(16) NOT NULL DEFAULT '',
+    statusContent VARCHAR(128) NOT NULL DEFAULT '',
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    botIndex INT NULL,
+    PRIMARY KEY (botId),
+    UNIQUE KEY whitelabel_bots_userId (userId)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,15 @@
+-- Responses to interactions that changed data, so that a redelivered
+-- interaction is answered with the original response instead of applying the
+-- change twice. Rows are pruned by the worker once they are past retention.
+
+CREATE TABLE IF NOT EXISTS processed_interactions (
+    interactionId VARCHAR(32) NOT NULL,
+    botId VARCHAR(32) NOT NULL,
+    status INT NULL,
+    contentType VARCHAR(100) NULL,
+    body MEDIUMBLOB NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completedAt DATETIME NULL,
+    PRIMARY KEY (interactionId),
+    KEY processed_interactions_createdAt (createdAt)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- Cooldowns guild admins have set with /settings cooldown in place of a
+-- command's default. Zero seconds turns the cooldown off.
+
+CREATE TABLE IF NOT EXISTS command_cooldowns (
+    guildId VARCHAR(32) NOT NULL,
+    command VARCHAR(32) NOT NULL,
+    seconds INT NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (guildId, command)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,10 @@
+-- Bumped whenever a guild's settings or level roles change, workers polling
+-- the table drop their cached copy of any guild whose version has moved.
+
+CREATE TABLE IF NOT EXISTS cache_versions (
+    guildId VARCHAR(32) NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    updatedAt DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (guildId),
+    KEY cache_versions_updatedAt (updatedAt)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
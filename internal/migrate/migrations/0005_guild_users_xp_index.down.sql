@@ -0,0 +1,2 @@
+-- The index is part of the schema 0001 creates, so it is left in place.
+DO 0;
@@ -0,0 +1,9 @@
+-- Ranks and leaderboard pages are read off this index. 0001 only creates it
+-- along with guild_users, so tables 0001 adopted don't have it. MySQL has no
+-- CREATE INDEX IF NOT EXISTS, so whether it exists is checked first.
+
+SET @exists = (SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'guild_users' AND index_name = 'guild_users_guildId_xp');
+SET @statement = IF(@exists = 0, 'CREATE INDEX guild_users_guildId_xp ON guild_users (guildId, xp)', 'DO 0');
+PREPARE createIndex FROM @statement;
+EXECUTE createIndex;
+DEALLOCATE PREPARE createIndex;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS public_key_versions;
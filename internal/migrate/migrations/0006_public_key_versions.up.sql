@@ -0,0 +1,10 @@
+-- Bumped whenever a whitelabel bot's public key changes, workers polling the
+-- table drop their cached copy of any bot whose version has moved.
+
+CREATE TABLE IF NOT EXISTS public_key_versions (
+    botId VARCHAR(32) NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    updatedAt DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (botId),
+    KEY public_key_versions_updatedAt (updatedAt)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,189 @@
+// Package rank works out where members are on their guild's leaderboard.
+// Positions are counted on the guild_users_guildId_xp index when asked for,
+// only member counts are cached.
+package rank
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	DefaultTotalTTL      = time.Minute
+	DefaultPruneInterval = 10 * time.Minute
+)
+
+// The leaderboard is ordered by XP, members with the same XP by user ID so
+// every member has a position of their own.
+const (
+	memberColumns = `gu.userId, gu.level, gu.xp, IF(u.discriminator = '0', u.username, CONCAT(u.username, "#", u.discriminator)) AS username`
+
+	rankQuery = "SELECT COUNT(*) FROM guild_users WHERE guildId = ? AND (xp > ? OR (xp = ? AND userId < ?))"
+
+	// The page is found on the index alone before the rows are read
+	pageQuery = "SELECT " + memberColumns + " FROM (SELECT userId FROM guild_users WHERE guildId = ? ORDER BY xp DESC, userId LIMIT ? OFFSET ?) page " +
+		"INNER JOIN guild_users gu ON gu.guildId = ? AND gu.userId = page.userId INNER JOIN users u ON gu.userId = u.id ORDER BY gu.xp DESC, gu.userId"
+	afterQuery = "SELECT " + memberColumns + " FROM guild_users gu INNER JOIN users u ON gu.userId = u.id " +
+		"WHERE gu.guildId = ? AND (gu.xp < ? OR (gu.xp = ? AND gu.userId > ?)) ORDER BY gu.xp DESC, gu.userId LIMIT ?"
+	beforeQuery = "SELECT " + memberColumns + " FROM guild_users gu INNER JOIN users u ON gu.userId = u.id " +
+		"WHERE gu.guildId = ? AND (gu.xp > ? OR (gu.xp = ? AND gu.userId < ?)) ORDER BY gu.xp ASC, gu.userId DESC LIMIT ?"
+)
+
+// Position is where a member is on the leaderboard of a guild with Total
+// members.
+type Position struct {
+	Rank  int
+	Total int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("Rank #%s of %s", formatCount(p.Rank), formatCount(p.Total))
+}
+
+type Member struct {
+	UserId   string `db:"userId"`
+	Username string `db:"username"`
+	Level    int    `db:"level"`
+	Xp       int64  `db:"xp"`
+}
+
+type total struct {
+	count     int
+	expiresAt time.Time
+}
+
+// Service looks up leaderboard positions. Member counts are cached for the
+// TTL given to NewService.
+type Service struct {
+	db  *sqlx.DB
+	ttl time.Duration
+
+	mu     sync.Mutex
+	totals map[string]total
+}
+
+// Rank returns the position of the member with xp.
+func (s *Service) Rank(ctx context.Context, guildId string, userId string, xp int64) (Position, error) {
+	var above int
+	if err := s.db.GetContext(ctx, &above, rankQuery, guildId, xp, xp, userId); err != nil {
+		return Position{}, err
+	}
+
+	count, err := s.Total(ctx, guildId)
+	if err != nil {
+		return Position{}, err
+	}
+
+	position := Position{Rank: above + 1, Total: count}
+	// The cached count can be behind members who have just joined
+	if position.Total < position.Rank {
+		position.Total = position.Rank
+	}
+
+	return position, nil
+}
+
+// Total returns how many members of the guild have XP.
+func (s *Service) Total(ctx context.Context, guildId string) (int, error) {
+	s.mu.Lock()
+	cached, ok := s.totals[guildId]
+	s.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.count, nil
+	}
+
+	var count int
+	if err := s.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM guild_users WHERE guildId = ?", guildId); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.totals[guildId] = total{count: count, expiresAt: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+
+	return count, nil
+}
+
+// Page returns the members on a page of the leaderboard, counting from 1.
+// Every member before the page is counted past, so deep pages should be read
+// with After instead.
+func (s *Service) Page(ctx context.Context, guildId string, page int, size int) ([]Member, error) {
+	var members []Member
+	err := s.db.SelectContext(ctx, &members, pageQuery, guildId, size, (page-1)*size, guildId)
+	return members, err
+}
+
+// After returns up to size members below the one with xp and userId, which
+// unlike Page doesn't get slower the further down the leaderboard it is.
+func (s *Service) After(ctx context.Context, guildId string, xp int64, userId string, size int) ([]Member, error) {
+	var members []Member
+	err := s.db.SelectContext(ctx, &members, afterQuery, guildId, xp, xp, userId, size)
+	return members, err
+}
+
+// Before returns up to size members above the one with xp and userId.
+func (s *Service) Before(ctx context.Context, guildId string, xp int64, userId string, size int) ([]Member, error) {
+	var members []Member
+	if err := s.db.SelectContext(ctx, &members, beforeQuery, guildId, xp, xp, userId, size); err != nil {
+		return nil, err
+	}
+
+	// They were read closest first
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+
+	return members, nil
+}
+
+// Prune removes expired member counts.
+func (s *Service) Prune() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for guildId, cached := range s.totals {
+		if now.After(cached.expiresAt) {
+			delete(s.totals, guildId)
+		}
+	}
+}
+
+// Run prunes the service every interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Prune()
+		}
+	}
+}
+
+func NewService(db *sqlx.DB, totalTtl time.Duration) *Service {
+	return &Service{
+		db:     db,
+		ttl:    totalTtl,
+		totals: map[string]total{},
+	}
+}
+
+// formatCount groups the digits of n in threes, 3120 becomes 3,120.
+func formatCount(n int) string {
+	digits := strconv.Itoa(n)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
@@ -0,0 +1,71 @@
+package rank_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/rank"
+)
+
+const (
+	guildId = "200000000000000002"
+	userId  = "400000000000000004"
+)
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		position rank.Position
+		want     string
+	}{
+		{rank.Position{Rank: 1, Total: 1}, "Rank #1 of 1"},
+		{rank.Position{Rank: 42, Total: 3120}, "Rank #42 of 3,120"},
+		{rank.Position{Rank: 999, Total: 1000000}, "Rank #999 of 1,000,000"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.position.String(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	defer mockDb.Close()
+
+	ranks := rank.NewService(sqlx.NewDb(mockDb, "mysql"), time.Minute)
+
+	expectAbove := func(above int) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM guild_users WHERE guildId = ? AND (xp > ? OR (xp = ? AND userId < ?))")).
+			WithArgs(guildId, 150, 150, userId).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(above))
+	}
+
+	expectAbove(41)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM guild_users WHERE guildId = ?")).
+		WithArgs(guildId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(50))
+	// The member count is cached, even when it falls behind
+	expectAbove(59)
+
+	for _, want := range []rank.Position{{Rank: 42, Total: 50}, {Rank: 60, Total: 60}} {
+		position, err := ranks.Rank(context.Background(), guildId, userId, 150)
+		if err != nil {
+			t.Fatalf("getting rank: %s", err)
+		}
+		if position != want {
+			t.Errorf("expected %+v, got %+v", want, position)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("database expectations: %s", err)
+	}
+}
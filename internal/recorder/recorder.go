@@ -0,0 +1,258 @@
+// Package recorder writes interactions and the responses sent for them to a
+// JSONL file per guild, so problems reported by a guild can be replayed
+// locally with `worker replay`.
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/common/logger"
+	"go.uber.org/zap"
+)
+
+// DirectMessages is the file name, without extension, interactions from
+// outside a guild are recorded under.
+const DirectMessages = "dm"
+
+// Entry is one recorded interaction. Interaction is the payload Discord sent
+// with its tokens removed, see Sanitize.
+type Entry struct {
+	Time        time.Time       `json:"time"`
+	BotId       string          `json:"botId"`
+	Interaction json.RawMessage `json:"interaction"`
+	Status      int             `json:"status"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+type Recorder struct {
+	dir string
+	// guilds limits recording to these guilds, or every guild when empty.
+	guilds map[string]bool
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// Middleware records every interaction except pings from the guilds being
+// recorded. It must run after the signature has been verified so only
+// interactions that really came from Discord are written.
+func (r *Recorder) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			var interaction struct {
+				Type    discordgo.InteractionType `json:"type"`
+				GuildId string                    `json:"guild_id"`
+			}
+			if err := json.Unmarshal(body, &interaction); err != nil || interaction.Type == discordgo.InteractionPing || !r.recording(interaction.GuildId) {
+				return next(c)
+			}
+
+			tee := &teeWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = tee
+
+			start := time.Now()
+			// Errors are turned into a response here rather than by echo once
+			// the middleware returns, so that the response is recorded
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			ctx := c.Request().Context()
+			if err := r.write(interaction.GuildId, start, c.Param("bot_id"), body, c.Response().Status, tee.body.Bytes()); err != nil {
+				logger.Error(ctx, "Error recording interaction", zap.String("guildId", interaction.GuildId), zap.Error(err))
+			}
+
+			return nil
+		}
+	}
+}
+
+func (r *Recorder) recording(guildId string) bool {
+	if len(r.guilds) == 0 {
+		return true
+	}
+	return r.guilds[guildId]
+}
+
+func (r *Recorder) write(guildId string, start time.Time, botId string, body []byte, status int, response []byte) error {
+	interaction, err := Sanitize(body)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{Time: start.UTC(), BotId: botId, Interaction: interaction, Status: status}
+	if json.Valid(response) {
+		entry.Response = response
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := r.file(guildId)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (r *Recorder) file(guildId string) (*os.File, error) {
+	name := DirectMessages
+	if guildId != "" {
+		name = guildId
+	}
+	// Guild IDs are only ever numbers, anything else can't become a path
+	if _, err := strconv.ParseUint(name, 10, 64); err != nil && name != DirectMessages {
+		return nil, fmt.Errorf("invalid guild id %q", guildId)
+	}
+
+	if file, ok := r.files[name]; ok {
+		return file, nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(r.dir, name+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	r.files[name] = file
+	return file, nil
+}
+
+// Close closes every file written to so far.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for name, file := range r.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.files, name)
+	}
+
+	return firstErr
+}
+
+// New creates a recorder writing to dir, creating it if needed. Only the
+// given guilds are recorded, or every guild and DM when none are given.
+func New(dir string, guilds []string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{dir: dir, guilds: map[string]bool{}, files: map[string]*os.File{}}
+	for _, guildId := range guilds {
+		r.guilds[guildId] = true
+	}
+
+	return r, nil
+}
+
+// Sanitize removes the interaction token, which can post as the bot for 15
+// minutes, and the value of any option with "token" in its name, such as the
+// bot token given to /whitelabel setup.
+func Sanitize(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var interaction map[string]any
+	if err := decoder.Decode(&interaction); err != nil {
+		return nil, err
+	}
+
+	delete(interaction, "token")
+	if data, ok := interaction["data"].(map[string]any); ok {
+		redactOptions(data["options"])
+	}
+
+	return json.Marshal(interaction)
+}
+
+func redactOptions(options any) {
+	list, ok := options.([]any)
+	if !ok {
+		return
+	}
+
+	for _, option := range list {
+		option, ok := option.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if name, _ := option["name"].(string); strings.Contains(strings.ToLower(name), "token") {
+			if _, ok := option["value"]; ok {
+				option["value"] = "[redacted]"
+			}
+		}
+		redactOptions(option["options"])
+	}
+}
+
+// Read returns the entries recorded in a file.
+func Read(reader io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		scanner = bufio.NewScanner(reader)
+		line    = 0
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+type teeWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	t.body.Write(b)
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *teeWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,127 @@
+package recorder_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/worker/internal/recorder"
+)
+
+const setupInteraction = `{"id":"1","type":2,"token":"interaction-token","guild_id":"200","data":{"name":"whitelabel","options":[{"name":"setup","type":1,"options":[{"name":"token","type":3,"value":"bot-token"},{"name":"public_key","type":3,"value":"key"}]}]}}`
+
+func TestSanitize(t *testing.T) {
+	sanitized, err := recorder.Sanitize([]byte(setupInteraction))
+	if err != nil {
+		t.Fatalf("sanitizing: %s", err)
+	}
+
+	for _, secret := range []string{"interaction-token", "bot-token"} {
+		if strings.Contains(string(sanitized), secret) {
+			t.Errorf("expected %s to be removed from %s", secret, sanitized)
+		}
+	}
+	if !strings.Contains(string(sanitized), `"value":"key"`) {
+		t.Errorf("expected other options to be kept in %s", sanitized)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := recorder.New(dir, []string{"200"})
+	if err != nil {
+		t.Fatalf("creating recorder: %s", err)
+	}
+
+	e := echo.New()
+	e.POST("/interactions/:bot_id", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource})
+	}, r.Middleware())
+
+	for _, body := range []string{
+		setupInteraction,
+		`{"id":"2","type":2,"token":"t","guild_id":"300","data":{"name":"level"}}`,
+		`{"id":"3","type":1}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/interactions/100", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("closing recorder: %s", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 || filepath.Base(files[0]) != "200.jsonl" {
+		t.Fatalf("expected only the recorded guild to be written, got %v", files)
+	}
+
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	entries, err := recorder.Read(file)
+	if err != nil {
+		t.Fatalf("reading recording: %s", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %d", len(entries))
+	}
+	if entry := entries[0]; entry.BotId != "100" || entry.Status != http.StatusOK || string(entry.Response) != `{"type":4}` {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if strings.Contains(string(entries[0].Interaction), "bot-token") {
+		t.Errorf("expected the interaction to be sanitized, got %s", entries[0].Interaction)
+	}
+}
+
+func TestMiddlewareRecordsErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := recorder.New(dir, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %s", err)
+	}
+
+	e := echo.New()
+	e.POST("/interactions/:bot_id", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown interaction")
+	}, r.Middleware())
+
+	req := httptest.NewRequest(http.MethodPost, "/interactions/100", strings.NewReader(`{"id":"2","type":2,"token":"t","guild_id":"300","data":{"name":"level"}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("closing recorder: %s", err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "300.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	entries, err := recorder.Read(file)
+	if err != nil {
+		t.Fatalf("reading recording: %s", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %d", len(entries))
+	}
+	if entry := entries[0]; entry.Status != http.StatusBadRequest || entry.Status != rec.Code || !strings.Contains(string(entry.Response), "unknown interaction") {
+		t.Errorf("expected the error response sent to be recorded, got %+v", entry)
+	}
+}
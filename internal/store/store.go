@@ -0,0 +1,257 @@
+// Package store caches the guild settings and level roles interactions read,
+// so they don't go to MySQL every time.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/common/logger"
+	"github.com/prosperitybot/common/model"
+	"github.com/prosperitybot/worker/internal/database"
+	"go.uber.org/zap"
+)
+
+const DefaultTTL = time.Minute
+
+type guildEntry struct {
+	guild     model.Guild
+	found     bool
+	expiresAt time.Time
+}
+
+type levelRolesEntry struct {
+	levelRoles []model.LevelRole
+	expiresAt  time.Time
+}
+
+// Store caches guild settings and level roles for the TTL given to NewStore.
+// Anything writing to the guilds or level_roles tables must call Invalidate
+// afterwards. A shared store also records invalidations in cache_versions,
+// where the stores of other workers pick them up in Run.
+//
+// Guilds are read from the replica, unless they changed too recently for it
+// to have caught up.
+type Store struct {
+	db     database.DB
+	ttl    time.Duration
+	shared bool
+	// replicaLag is how long a changed guild is read from the primary
+	// database rather than the replica, so the change isn't missed and
+	// cached for a TTL.
+	replicaLag time.Duration
+
+	mu         sync.Mutex
+	guilds     map[string]guildEntry
+	levelRoles map[string]levelRolesEntry
+	// generation is bumped by every invalidation, a load that started before
+	// one may have read what was just changed and isn't cached.
+	generation uint64
+	// since is the time of the latest cache_versions change polled. The next
+	// poll returns the changes made at exactly that time again, seen holds
+	// their versions so they aren't counted twice.
+	since time.Time
+	seen  map[string]int64
+	// changed is when guilds were last invalidated, while the replica may
+	// still be behind.
+	changed map[string]time.Time
+}
+
+// Guild returns the settings of a guild, or false if it has none.
+func (s *Store) Guild(ctx context.Context, guildId string) (model.Guild, bool, error) {
+	s.mu.Lock()
+	entry, ok := s.guilds[guildId]
+	generation := s.generation
+	db := s.reader(guildId)
+	s.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.guild, entry.found, nil
+	}
+
+	entry = guildEntry{found: true, expiresAt: time.Now().Add(s.ttl)}
+	if err := db.GetContext(ctx, &entry.guild, "SELECT * FROM guilds WHERE id = ?", guildId); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return model.Guild{}, false, err
+		}
+		entry.found = false
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.guilds[guildId] = entry
+	}
+	s.mu.Unlock()
+
+	return entry.guild, entry.found, nil
+}
+
+// LevelRoles returns the level roles of a guild, lowest level first.
+func (s *Store) LevelRoles(ctx context.Context, guildId string) ([]model.LevelRole, error) {
+	s.mu.Lock()
+	entry, ok := s.levelRoles[guildId]
+	generation := s.generation
+	db := s.reader(guildId)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		entry = levelRolesEntry{expiresAt: time.Now().Add(s.ttl)}
+		if err := db.SelectContext(ctx, &entry.levelRoles, "SELECT * FROM level_roles WHERE guildId = ? ORDER BY level", guildId); err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		if s.generation == generation {
+			s.levelRoles[guildId] = entry
+		}
+		s.mu.Unlock()
+	}
+
+	// Callers are free to change what they get back
+	return append([]model.LevelRole(nil), entry.levelRoles...), nil
+}
+
+// Invalidate drops everything cached about the guild. The local cache is
+// always cleared, an error means other workers may not hear about it until
+// their copy expires.
+func (s *Store) Invalidate(ctx context.Context, guildId string) error {
+	s.forget(guildId)
+
+	if !s.shared {
+		return nil
+	}
+
+	_, err := s.db.Writer.ExecContext(ctx, "INSERT INTO cache_versions (guildId) VALUES (?) ON DUPLICATE KEY UPDATE version = version + 1", guildId)
+	return err
+}
+
+func (s *Store) forget(guildId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.guilds, guildId)
+	delete(s.levelRoles, guildId)
+	s.generation++
+
+	if s.db.Replicated() {
+		s.changed[guildId] = time.Now()
+	}
+}
+
+// reader returns the database to read the guild from, s.mu must be held.
+func (s *Store) reader(guildId string) *sqlx.DB {
+	if changed, ok := s.changed[guildId]; ok && time.Since(changed) < s.replicaLag {
+		return s.db.Writer
+	}
+	return s.db.Reader
+}
+
+// Poll drops the guilds other workers have invalidated since the last poll,
+// returning how many there were. The first poll reads every version so it
+// drops anything cached before it. Polls must not run concurrently.
+func (s *Store) Poll(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	since := s.since
+	s.mu.Unlock()
+
+	var versions []struct {
+		GuildId   string    `db:"guildId"`
+		Version   int64     `db:"version"`
+		UpdatedAt time.Time `db:"updatedAt"`
+	}
+	if err := s.db.Writer.SelectContext(ctx, &versions, "SELECT guildId, version, updatedAt FROM cache_versions WHERE updatedAt >= ? ORDER BY updatedAt", since); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, version := range versions {
+		if seen, ok := s.seen[version.GuildId]; ok && seen == version.Version {
+			continue
+		}
+
+		s.forget(version.GuildId)
+		changed++
+
+		if version.UpdatedAt.After(since) {
+			since = version.UpdatedAt
+			s.seen = map[string]int64{}
+		}
+		if version.UpdatedAt.Equal(since) {
+			s.seen[version.GuildId] = version.Version
+		}
+	}
+
+	s.mu.Lock()
+	s.since = since
+	s.mu.Unlock()
+
+	return changed, nil
+}
+
+// Prune removes expired entries.
+func (s *Store) Prune() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for guildId, entry := range s.guilds {
+		if now.After(entry.expiresAt) {
+			delete(s.guilds, guildId)
+		}
+	}
+	for guildId, entry := range s.levelRoles {
+		if now.After(entry.expiresAt) {
+			delete(s.levelRoles, guildId)
+		}
+	}
+	for guildId, changed := range s.changed {
+		if now.Sub(changed) >= s.replicaLag {
+			delete(s.changed, guildId)
+		}
+	}
+}
+
+// Run prunes the store and, when it is shared, polls for other workers'
+// invalidations every interval until ctx is cancelled.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.shared {
+			if changed, err := s.Poll(ctx); err != nil {
+				logger.Error(ctx, "Error polling cache versions", zap.Error(err))
+			} else if changed > 0 {
+				logger.Debug(ctx, "Invalidated cached guilds changed elsewhere", zap.Int("count", changed))
+			}
+		}
+		s.Prune()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewStore creates a store caching for ttl. shared should be set when more
+// than one worker uses the database, Run must then be started to hear about
+// the others' changes. replicaLag is how far behind db's replica can be.
+func NewStore(db database.DB, ttl time.Duration, replicaLag time.Duration, shared bool) *Store {
+	return &Store{
+		db:         db,
+		ttl:        ttl,
+		shared:     shared,
+		replicaLag: replicaLag,
+		guilds:     map[string]guildEntry{},
+		levelRoles: map[string]levelRolesEntry{},
+		seen:       map[string]int64{},
+		changed:    map[string]time.Time{},
+	}
+}
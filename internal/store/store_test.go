@@ -0,0 +1,222 @@
+package store_test
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperitybot/worker/internal/database"
+	"github.com/prosperitybot/worker/internal/store"
+)
+
+const guildId = "200000000000000002"
+
+func newMock(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating database mock: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("database expectations: %s", err)
+		}
+		mockDb.Close()
+	})
+
+	return sqlx.NewDb(mockDb, "mysql"), mock
+}
+
+func newStore(t *testing.T, shared bool) (*store.Store, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock := newMock(t)
+	return store.NewStore(database.NewDB(db, nil), time.Minute, 0, shared), mock
+}
+
+func expectGuild(mock sqlmock.Sqlmock, notificationType string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM guilds WHERE id = ?")).
+		WithArgs(guildId).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notificationType"}).AddRow(guildId, notificationType))
+}
+
+func expectLevelRoles(mock sqlmock.Sqlmock, levels ...int) {
+	rows := sqlmock.NewRows([]string{"id", "guildId", "level"})
+	for _, level := range levels {
+		rows.AddRow("role-"+strconv.Itoa(level), guildId, level)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM level_roles WHERE guildId = ? ORDER BY level")).
+		WithArgs(guildId).
+		WillReturnRows(rows)
+}
+
+func expectVersions(mock sqlmock.Sqlmock, since time.Time, versions ...interface{}) {
+	rows := sqlmock.NewRows([]string{"guildId", "version", "updatedAt"})
+	for n := 0; n < len(versions); n += 3 {
+		rows.AddRow(versions[n], versions[n+1], versions[n+2])
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT guildId, version, updatedAt FROM cache_versions WHERE updatedAt >= ? ORDER BY updatedAt")).
+		WithArgs(since).
+		WillReturnRows(rows)
+}
+
+func TestGuildCached(t *testing.T) {
+	s, mock := newStore(t, false)
+	expectGuild(mock, "dm")
+
+	for n := 0; n < 2; n++ {
+		guild, found, err := s.Guild(context.Background(), guildId)
+		if err != nil {
+			t.Fatalf("getting guild: %s", err)
+		}
+		if !found || guild.NotificationType != "dm" {
+			t.Errorf("unexpected guild %+v (found %t)", guild, found)
+		}
+	}
+}
+
+func TestMissingGuildCached(t *testing.T) {
+	s, mock := newStore(t, false)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM guilds WHERE id = ?")).
+		WithArgs(guildId).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	for n := 0; n < 2; n++ {
+		if _, found, err := s.Guild(context.Background(), guildId); err != nil || found {
+			t.Errorf("expected no guild, got found %t and %v", found, err)
+		}
+	}
+}
+
+func TestLevelRolesCached(t *testing.T) {
+	s, mock := newStore(t, false)
+	expectLevelRoles(mock, 5)
+
+	for n := 0; n < 2; n++ {
+		levelRoles, err := s.LevelRoles(context.Background(), guildId)
+		if err != nil {
+			t.Fatalf("getting level roles: %s", err)
+		}
+		if len(levelRoles) != 1 || levelRoles[0].Level != 5 {
+			t.Errorf("unexpected level roles %+v", levelRoles)
+		}
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	s, mock := newStore(t, false)
+	expectLevelRoles(mock, 5)
+	expectLevelRoles(mock, 5, 10)
+
+	if _, err := s.LevelRoles(context.Background(), guildId); err != nil {
+		t.Fatalf("getting level roles: %s", err)
+	}
+	if err := s.Invalidate(context.Background(), guildId); err != nil {
+		t.Fatalf("invalidating: %s", err)
+	}
+
+	levelRoles, err := s.LevelRoles(context.Background(), guildId)
+	if err != nil {
+		t.Fatalf("getting level roles: %s", err)
+	}
+	if len(levelRoles) != 2 {
+		t.Errorf("expected the level roles to be read again, got %+v", levelRoles)
+	}
+}
+
+func TestInvalidateShared(t *testing.T) {
+	s, mock := newStore(t, true)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO cache_versions (guildId) VALUES (?) ON DUPLICATE KEY UPDATE version = version + 1")).
+		WithArgs(guildId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := s.Invalidate(context.Background(), guildId); err != nil {
+		t.Fatalf("invalidating: %s", err)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	var (
+		s, mock = newStore(t, true)
+		ctx     = context.Background()
+		changed = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	poll := func(want int) {
+		t.Helper()
+
+		got, err := s.Poll(ctx)
+		if err != nil {
+			t.Fatalf("polling: %s", err)
+		}
+		if got != want {
+			t.Errorf("expected %d changed guilds, got %d", want, got)
+		}
+	}
+
+	guild := func(want string) {
+		t.Helper()
+
+		guild, _, err := s.Guild(ctx, guildId)
+		if err != nil {
+			t.Fatalf("getting guild: %s", err)
+		}
+		if guild.NotificationType != want {
+			t.Errorf("expected notification type %q, got %q", want, guild.NotificationType)
+		}
+	}
+
+	expectGuild(mock, "dm")
+	guild("dm")
+
+	// Another worker changed the guild
+	expectVersions(mock, time.Time{}, guildId, 1, changed)
+	poll(1)
+	expectGuild(mock, "reply")
+	guild("reply")
+
+	// The change is returned again as it was made at the time polled from,
+	// but the guild stays cached
+	expectVersions(mock, changed, guildId, 1, changed)
+	poll(0)
+	guild("reply")
+
+	// Changed again within the same millisecond
+	expectVersions(mock, changed, guildId, 2, changed)
+	poll(1)
+	expectGuild(mock, "disable")
+	guild("disable")
+}
+
+func TestReadsFromReplica(t *testing.T) {
+	var (
+		writerDb, writer = newMock(t)
+		readerDb, reader = newMock(t)
+		s                = store.NewStore(database.NewDB(writerDb, readerDb), time.Minute, 10*time.Second, false)
+	)
+
+	expectLevelRoles(reader, 5)
+	if _, err := s.LevelRoles(context.Background(), guildId); err != nil {
+		t.Fatalf("getting level roles: %s", err)
+	}
+
+	// The replica may not have the change yet
+	expectLevelRoles(writer, 5, 10)
+	if err := s.Invalidate(context.Background(), guildId); err != nil {
+		t.Fatalf("invalidating: %s", err)
+	}
+	levelRoles, err := s.LevelRoles(context.Background(), guildId)
+	if err != nil {
+		t.Fatalf("getting level roles: %s", err)
+	}
+	if len(levelRoles) != 2 {
+		t.Errorf("expected the level roles from the primary, got %+v", levelRoles)
+	}
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/worker/internal/config"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/profiler"
+
+	sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
+	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/labstack/echo.v4"
+)
+
+type datadogTracer struct {
+	serviceName string
+}
+
+type datadogSpan struct {
+	span ddtrace.Span
+	err  error
+}
+
+func (s *datadogSpan) SetTag(key string, value any) {
+	s.span.SetTag(key, value)
+}
+
+func (s *datadogSpan) SetError(err error) {
+	s.err = err
+}
+
+func (s *datadogSpan) End() {
+	s.span.Finish(tracer.WithError(s.err))
+}
+
+func (t datadogTracer) Middleware() echo.MiddlewareFunc {
+	return httptrace.Middleware(httptrace.WithServiceName(t.serviceName))
+}
+
+func (t datadogTracer) OpenDB(d driver.Driver, dsn string) (*sql.DB, error) {
+	sqltrace.Register("mysql", d, sqltrace.WithServiceName(t.serviceName))
+	return sqltrace.Open("mysql", dsn)
+}
+
+func (t datadogTracer) StartSpan(ctx context.Context, operation string) (context.Context, Span) {
+	span, ctx := tracer.StartSpanFromContext(ctx, operation, tracer.ServiceName(t.serviceName))
+	return ctx, &datadogSpan{span: span}
+}
+
+func (t datadogTracer) Shutdown(ctx context.Context) error {
+	profiler.Stop()
+	tracer.Stop()
+	return nil
+}
+
+func newDatadogTracer(cfg config.Tracing) (Tracer, error) {
+	tracer.Start(tracer.WithService(cfg.ServiceName))
+
+	err := profiler.Start(
+		profiler.WithService(cfg.ServiceName),
+		profiler.WithProfileTypes(
+			profiler.CPUProfile,
+			profiler.HeapProfile,
+		),
+	)
+	if err != nil {
+		tracer.Stop()
+		return nil, err
+	}
+
+	return datadogTracer{serviceName: cfg.ServiceName}, nil
+}
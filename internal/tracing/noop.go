@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/labstack/echo/v4"
+)
+
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value any) {}
+func (noopSpan) SetError(err error)           {}
+func (noopSpan) End()                         {}
+
+func (noopTracer) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return next
+	}
+}
+
+func (noopTracer) OpenDB(d driver.Driver, dsn string) (*sql.DB, error) {
+	return sql.OpenDB(dsnConnector{dsn: dsn, driver: d}), nil
+}
+
+func (noopTracer) StartSpan(ctx context.Context, operation string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Noop returns a tracer that records nothing, used when tracing is disabled
+// and by the CLI commands that don't serve requests.
+func Noop() Tracer {
+	return noopTracer{}
+}
@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/worker/internal/config"
+	"github.com/prosperitybot/worker/internal/database"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// otelTracer exports spans over OTLP/HTTP. The exporter reads the standard
+// OTEL_EXPORTER_OTLP_* environment variables for its endpoint and headers.
+type otelTracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetTag(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case float64:
+		s.span.SetAttributes(attribute.Float64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+func (s otelSpan) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
+
+func (t otelTracer) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := t.propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			ctx, span := t.tracer.Start(ctx, fmt.Sprintf("%s %s", req.Method, c.Path()),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPMethod(req.Method),
+					semconv.HTTPRoute(c.Path()),
+					semconv.HTTPTarget(req.URL.Path),
+				),
+			)
+			defer span.End()
+
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPStatusCode(status))
+			if status >= 500 {
+				span.SetStatus(codes.Error, "")
+			}
+
+			return err
+		}
+	}
+}
+
+func (t otelTracer) OpenDB(d driver.Driver, dsn string) (*sql.DB, error) {
+	return sql.OpenDB(dsnConnector{dsn: dsn, driver: database.WrapDriver(d, t.databaseHook)}), nil
+}
+
+// databaseHook records a span for each statement after it has run, using the
+// statement's own start time. Statements run outside of a trace (such as
+// connection pool housekeeping) are skipped.
+func (t otelTracer) databaseHook(ctx context.Context, event database.QueryEvent) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+
+	_, span := t.tracer.Start(ctx, "sql."+event.Operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(event.Start),
+		trace.WithAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBStatement(event.Query),
+			semconv.DBOperation(event.Operation),
+		),
+	)
+
+	if event.Err != nil {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+
+	span.End(trace.WithTimestamp(event.Start.Add(event.Duration)))
+}
+
+func (t otelTracer) StartSpan(ctx context.Context, operation string) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, operation)
+	return ctx, otelSpan{span: span}
+}
+
+func (t otelTracer) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+func newOtelTracer(ctx context.Context, cfg config.Tracing) (Tracer, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return otelTracer{
+		provider:   provider,
+		tracer:     provider.Tracer("github.com/prosperitybot/worker"),
+		propagator: propagator,
+	}, nil
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prosperitybot/worker/internal/config"
+)
+
+const (
+	BackendDatadog       = "datadog"
+	BackendOpenTelemetry = "otel"
+	BackendNone          = "none"
+)
+
+type Span interface {
+	SetTag(key string, value any)
+	SetError(err error)
+	End()
+}
+
+// Tracer hides which tracing backend is in use from the rest of the worker.
+type Tracer interface {
+	// Middleware starts a span for every HTTP request.
+	Middleware() echo.MiddlewareFunc
+	// OpenDB opens a database whose queries are traced.
+	OpenDB(d driver.Driver, dsn string) (*sql.DB, error)
+	StartSpan(ctx context.Context, operation string) (context.Context, Span)
+	// Shutdown flushes any buffered spans.
+	Shutdown(ctx context.Context) error
+}
+
+func New(ctx context.Context, cfg config.Tracing) (Tracer, error) {
+	switch cfg.Backend {
+	case BackendDatadog:
+		return newDatadogTracer(cfg)
+	case BackendOpenTelemetry:
+		return newOtelTracer(ctx, cfg)
+	case BackendNone:
+		return Noop(), nil
+	}
+
+	return nil, fmt.Errorf("unknown tracing backend %q", cfg.Backend)
+}
+
+// dsnConnector mirrors the connector database/sql uses for sql.Open, without
+// having to register the driver globally.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}